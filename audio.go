@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"github.com/lxc/lxd/shared"
+)
+
+//sharing the audio sockets of the user is opt-in, as it allows the
+//container to record audio as well
+var AudioConfig string = "user.usdk-audio"
+
+//disk devices sharing the audio sockets are named with this prefix
+const AudioDevicePrefix = "audio_"
+
+//the directory the audio sockets are mounted to inside the container
+const AudioDir = "/var/lib/usdk-audio"
+
+//AudioSocket is a native socket of the sound server of the user, only the
+//socket is shared, its directory is usually XDG_RUNTIME_DIR which contains
+//the other sockets of the session as well
+type AudioSocket struct {
+	Device string
+	//path of the socket on the host
+	Source string
+	//path of the socket inside the container
+	Path string
+	//variable pointing the clients to the socket
+	EnvName string
+	EnvValue string
+}
+
+func AudioEnabled (config map[string]string) bool {
+	return config[AudioConfig] == "true"
+}
+
+func newAudioSocket (name, source, envName, envFormat string) AudioSocket {
+	path := filepath.Join(AudioDir, name, filepath.Base(source))
+	return AudioSocket{
+		Device: AudioDevicePrefix + name,
+		Source: source,
+		Path: path,
+		EnvName: envName,
+		EnvValue: fmt.Sprintf(envFormat, path),
+	}
+}
+
+//FindAudioSockets returns the sockets of the sound servers running in the
+//session described by environ, in the form of os.Environ. PipeWire provides
+//the PulseAudio socket as well when pipewire-pulse is running
+func FindAudioSockets (environ []string) []AudioSocket {
+	sockets := []AudioSocket{}
+
+	pulse := ""
+	if server := lookupEnv(environ, "PULSE_SERVER"); strings.HasPrefix(server, "unix:") {
+		pulse = strings.TrimPrefix(server, "unix:")
+	} else if runtimeDir := lookupEnv(environ, "XDG_RUNTIME_DIR"); len(runtimeDir) > 0 {
+		pulse = filepath.Join(runtimeDir, "pulse", "native")
+	}
+	if _, err := os.Stat(pulse); len(pulse) > 0 && err == nil {
+		sockets = append(sockets, newAudioSocket("pulse", pulse, "PULSE_SERVER", "unix:%s"))
+	}
+
+	if runtimeDir := lookupEnv(environ, "XDG_RUNTIME_DIR"); len(runtimeDir) > 0 {
+		pipewire := filepath.Join(runtimeDir, "pipewire-0")
+		if _, err := os.Stat(pipewire); err == nil {
+			sockets = append(sockets, newAudioSocket("pipewire", pipewire, "PIPEWIRE_REMOTE", "%s"))
+		}
+	}
+	return sockets
+}
+
+//Props returns the properties of the disk device sharing the socket, the
+//container has to start when the sound server is not running
+func (s *AudioSocket) Props () []string {
+	return []string{
+		fmt.Sprintf("source=%s", s.Source),
+		fmt.Sprintf("path=%s", s.Path),
+		"optional=true",
+	}
+}
+
+//Shared returns true if the device shares the socket
+func (s *AudioSocket) Shared (dev shared.Device) bool {
+	return SameDevice(dev, DeviceFromProps("disk", s.Props()))
+}
+
+//AudioEnvironment returns the variables pointing the clients in the container
+//to the sound servers of the session, if audio is enabled for the container.
+//The error lists the sockets that moved since they were shared
+func AudioEnvironment (info *shared.ContainerInfo, environ []string) (map[string]string, error) {
+	env := map[string]string{}
+	if !AudioEnabled(info.ExpandedConfig) {
+		return env, nil
+	}
+
+	changed := []string{}
+	for _, socket := range FindAudioSockets(environ) {
+		if dev, ok := info.ExpandedDevices[socket.Device]; ok && socket.Shared(dev) {
+			env[socket.EnvName] = socket.EnvValue
+		} else {
+			changed = append(changed, socket.Source)
+		}
+	}
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		return env, fmt.Errorf("The audio sockets %s are not shared with %s, share them with: usdk-target autofix audio",
+			strings.Join(changed, ", "), info.Name)
+	}
+	return env, nil
+}
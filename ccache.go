@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"context"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+var CCacheConfig string = "user.usdk-ccache"
+
+const CCacheDeviceName = "ccache"
+const CCacheContainerPath = "/var/cache/usdk-ccache"
+const ccacheProfileFile = "/etc/profile.d/usdk-ccache.sh"
+
+//masquerading the compilers is done by putting the ccache links first in PATH
+var ccacheProfile = `export CCACHE_DIR=` + CCacheContainerPath + `
+case ":$PATH:" in
+	*:/usr/lib/ccache:*) ;;
+	*) export PATH=/usr/lib/ccache:$PATH ;;
+esac
+`
+
+//CCacheHostDir returns the cache directory shared by all targets with the
+//same framework and architecture
+func CCacheHostDir (home, framework, architecture string) string {
+	return filepath.Join(home, ".cache", "ubuntu-sdk-tools", "ccache", framework+"-"+architecture)
+}
+
+func CCacheEnabled (config map[string]string) bool {
+	return config[CCacheConfig] == "true"
+}
+
+//EnableCCache mounts the shared cache directory of the user into the
+//container and configures ccache to be used for all builds
+func EnableCCache (ctx context.Context, client *lxd.Client, container, framework, architecture string, pw *Passwd) error {
+	hostDir := CCacheHostDir(pw.Dir, framework, architecture)
+	err := shared.MkdirAllOwner(hostDir, 0755, int(pw.Uid), int(pw.Gid))
+	if err != nil {
+		return fmt.Errorf("Could not create the ccache directory %s. error: %v", hostDir, err)
+	}
+
+	err = AddDeviceSync(ctx, client, container, CCacheDeviceName, "disk",
+		[]string{fmt.Sprintf("source=%s", hostDir), fmt.Sprintf("path=%s", CCacheContainerPath)})
+	if err != nil {
+		return err
+	}
+
+	err = BootContainerSync(ctx, client, container)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(InfoOutput, "Installing ccache\n")
+	res, err := ExecSync(client, container, []string{
+		"/bin/bash", "-c", "command -v ccache >/dev/null || (apt-get update && apt-get install --yes ccache)",
+	})
+	if err != nil {
+		return err
+	}
+	if res.Code != 0 {
+		return fmt.Errorf("Installing ccache failed with exit code %d: %s", res.Code, res.Stderr)
+	}
+
+	err = client.PushFile(container, ccacheProfileFile, 0, 0, "0644", bytes.NewReader([]byte(ccacheProfile)))
+	if err != nil {
+		return fmt.Errorf("Could not configure ccache. error: %v", err)
+	}
+
+	return client.SetContainerConfig(container, CCacheConfig, "true")
+}
+
+var ccacheStatPatterns = map[string]*regexp.Regexp{
+	//ccache 3.x
+	"hits": regexp.MustCompile(`(?m)^cache hit \((?:direct|preprocessed)\)\s+(\d+)`),
+	"misses": regexp.MustCompile(`(?m)^cache miss\s+(\d+)`),
+	"size": regexp.MustCompile(`(?m)^cache size\s+(.+)$`),
+	//ccache 4.x
+	"hits4": regexp.MustCompile(`(?m)^\s+Hits:\s+(\d+)`),
+	"misses4": regexp.MustCompile(`(?m)^\s+Misses:\s+(\d+)`),
+	"size4": regexp.MustCompile(`(?m)^\s+Cache size \((\w+)\):\s+([\d.]+)`),
+}
+
+func sumMatches (re *regexp.Regexp, out string) (int, bool) {
+	matches := re.FindAllStringSubmatch(out, -1)
+	sum := 0
+	for _, match := range matches {
+		val, _ := strconv.Atoi(match[1])
+		sum += val
+	}
+	return sum, len(matches) > 0
+}
+
+//CCacheStats returns the size and the hit statistics of the cache used by
+//a running container
+func CCacheStats (client *lxd.Client, container string) (map[string]string, error) {
+	res, err := ExecSync(client, container, []string{
+		"env", "CCACHE_DIR="+CCacheContainerPath, "ccache", "-s",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Code != 0 {
+		return nil, fmt.Errorf("Querying the ccache statistics failed: %s", res.Stderr)
+	}
+
+	return parseCCacheStats(res.Stdout), nil
+}
+
+//parseCCacheStats parses the output of ccache -s, ccache 3 lists the direct
+//and preprocessed hits separately, ccache 4 repeats the hits and misses for
+//every storage after the totals in the "Cacheable calls" block
+func parseCCacheStats (out string) map[string]string {
+	stats := map[string]string{}
+	if hits, ok := sumMatches(ccacheStatPatterns["hits"], out); ok {
+		stats["hits"] = strconv.Itoa(hits)
+	} else if match := ccacheStatPatterns["hits4"].FindStringSubmatch(out); match != nil {
+		stats["hits"] = match[1]
+	}
+
+	if misses, ok := sumMatches(ccacheStatPatterns["misses"], out); ok {
+		stats["misses"] = strconv.Itoa(misses)
+	} else if match := ccacheStatPatterns["misses4"].FindStringSubmatch(out); match != nil {
+		stats["misses"] = match[1]
+	}
+
+	if match := ccacheStatPatterns["size"].FindStringSubmatch(out); match != nil {
+		stats["size"] = strings.TrimSpace(match[1])
+	} else if match := ccacheStatPatterns["size4"].FindStringSubmatch(out); match != nil {
+		stats["size"] = match[2] + " " + match[1]
+	}
+	return stats
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+var ccache3Stats = `cache directory                     /var/cache/usdk-ccache
+primary config                      /var/cache/usdk-ccache/ccache.conf
+secondary config      (readonly)    /etc/ccache.conf
+stats updated                       Tue Jul 12 10:21:43 2016
+cache hit (direct)                   100
+cache hit (preprocessed)              20
+cache miss                            30
+cache hit rate                     80.00 %
+called for link                        5
+compile failed                         2
+files in cache                       300
+cache size                          12.3 MB
+max cache size                       5.0 GB
+`
+
+var ccache4Stats = `Cacheable calls:   150 / 160 (93.75%)
+  Hits:            120 / 150 (80.00%)
+    Direct:        100 / 120 (83.33%)
+    Preprocessed:   20 / 120 (16.67%)
+  Misses:           30 / 150 (20.00%)
+Uncacheable calls:  10 / 160 ( 6.25%)
+Local storage:
+  Cache size (GB): 1.2 / 5.0 (24.00%)
+  Files:           300
+  Hits:            120 / 150 (80.00%)
+  Misses:           30 / 150 (20.00%)
+`
+
+func TestParseCCacheStats (t *testing.T) {
+	tests := []struct {
+		name string
+		out string
+		want map[string]string
+	}{
+		{
+			name: "ccache 3",
+			out: ccache3Stats,
+			want: map[string]string{"hits": "120", "misses": "30", "size": "12.3 MB"},
+		},
+		{
+			name: "ccache 4",
+			out: ccache4Stats,
+			want: map[string]string{"hits": "120", "misses": "30", "size": "1.2 GB"},
+		},
+		{
+			name: "empty cache",
+			out: "",
+			want: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		if got := parseCCacheStats(test.out); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+const cancelTimeout = 5 * time.Second
+
+//contextError returns the error describing why ctx is done, naming the
+//operation that was running at that time
+func contextError (ctx context.Context, operation string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &ErrTimeout{Operation: operation}
+	}
+	return &ErrCanceled{Operation: operation}
+}
+
+//RunWithContext runs fn and returns early if ctx is done before fn
+//finished, the LXD client can not be interrupted so fn keeps running
+//in the background in that case
+func RunWithContext (ctx context.Context, operation string, fn func() error) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, operation)
+	}
+
+	done := make(chan error, 1)
+	go func () {
+		done <- fn()
+	} ()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx, operation)
+	}
+}
+
+//WaitForOperation waits for a LXD operation to succeed, if ctx is done
+//before that the operation is canceled, as far as LXD supports it
+func WaitForOperation (ctx context.Context, client *lxd.Client, opUrl string, operation string) error {
+	err := RunWithContext(ctx, operation, func () error {
+		return client.WaitForSuccess(opUrl)
+	})
+
+	if err != nil && ctx.Err() != nil {
+		cancelOperation(client, opUrl)
+	}
+	return err
+}
+
+//cancelOperation asks LXD to cancel the operation, errors are ignored
+//because most operations can not be canceled anyway
+func cancelOperation (client *lxd.Client, opUrl string) {
+	req, err := http.NewRequest("DELETE", client.BaseURL+opUrl, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", shared.UserAgent)
+
+	//do not hang on a server that stopped responding
+	httpClient := client.Http
+	httpClient.Timeout = cancelTimeout
+
+	resp, err := httpClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
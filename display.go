@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"github.com/lxc/lxd/shared"
+)
+
+//disk devices sharing the display of the session are named with this prefix
+const DisplayDevicePrefix = "display_"
+
+//the directory display files that are not reachable otherwise are mounted to
+const DisplayDir = "/var/lib/usdk-display"
+
+//the directory containing the X11 sockets, it is shared under the same path
+const X11SocketDir = "/tmp/.X11-unix"
+
+//DisplaySession describes the display of the calling session
+type DisplaySession struct {
+	//the X11 display, only set for displays reachable over the local socket
+	X11Display string
+	//the file containing the X11 cookie
+	XAuthority string
+	//the absolute path of the Wayland socket
+	WaylandSocket string
+}
+
+func lookupEnv (environ []string, name string) string {
+	for _, entry := range environ {
+		if strings.HasPrefix(entry, name+"=") {
+			return strings.TrimPrefix(entry, name+"=")
+		}
+	}
+	return ""
+}
+
+//NewDisplaySession reads the display of the session from environ,
+//in the form of os.Environ
+func NewDisplaySession (environ []string) *DisplaySession {
+	session := &DisplaySession{}
+
+	//remote displays like the ones forwarded by ssh can not be shared
+	display := lookupEnv(environ, "DISPLAY")
+	if strings.HasPrefix(display, ":") || strings.HasPrefix(display, "unix:") {
+		session.X11Display = display
+
+		session.XAuthority = lookupEnv(environ, "XAUTHORITY")
+		if len(session.XAuthority) == 0 {
+			if home := lookupEnv(environ, "HOME"); len(home) > 0 {
+				session.XAuthority = filepath.Join(home, ".Xauthority")
+			}
+		}
+		if _, err := os.Stat(session.XAuthority); err != nil {
+			session.XAuthority = ""
+		}
+	}
+
+	if wayland := lookupEnv(environ, "WAYLAND_DISPLAY"); len(wayland) > 0 {
+		if !filepath.IsAbs(wayland) {
+			wayland = filepath.Join(lookupEnv(environ, "XDG_RUNTIME_DIR"), wayland)
+		}
+		if _, err := os.Stat(wayland); err == nil && filepath.IsAbs(wayland) {
+			session.WaylandSocket = wayland
+		}
+	}
+
+	return session
+}
+
+//HasDisplay returns true if the session has a display that can be shared
+func (s *DisplaySession) HasDisplay () bool {
+	return len(s.X11Display) > 0 || len(s.WaylandSocket) > 0
+}
+
+//HostPaths returns the host paths a container needs to reach to use the
+//display, by the name of the device that shares them. Only the files are
+//shared, the cookie and the Wayland socket usually live in XDG_RUNTIME_DIR
+//next to the other sockets of the session
+func (s *DisplaySession) HostPaths () map[string]string {
+	paths := map[string]string{}
+	if len(s.X11Display) > 0 {
+		paths[DisplayDevicePrefix+"x11"] = X11SocketDir
+	}
+	if len(s.XAuthority) > 0 {
+		paths[DisplayDevicePrefix+"xauthority"] = s.XAuthority
+	}
+	if len(s.WaylandSocket) > 0 {
+		paths[DisplayDevicePrefix+"wayland"] = s.WaylandSocket
+	}
+	return paths
+}
+
+//DisplayDeviceProps returns the properties of the disk device sharing the
+//host path, the X11 sockets have to show up under the same path. The files
+//belong to the session, the container has to start without them
+func DisplayDeviceProps (devName, hostPath string) []string {
+	containerPath := hostPath
+	if hostPath != X11SocketDir {
+		containerPath = filepath.Join(DisplayDir, strings.TrimPrefix(devName, DisplayDevicePrefix), filepath.Base(hostPath))
+	}
+	return []string{
+		fmt.Sprintf("source=%s", hostPath),
+		fmt.Sprintf("path=%s", containerPath),
+		"optional=true",
+	}
+}
+
+//Environment returns the variables pointing the applications in the
+//container to the display, the error lists the parts that are not shared
+func (s *DisplaySession) Environment (info *shared.ContainerInfo) (map[string]string, error) {
+	paths := SharedPaths(info)
+	env := map[string]string{}
+	missing := []string{}
+
+	if len(s.X11Display) > 0 {
+		if dir, ok := MapHostPath(paths, X11SocketDir); ok && dir == X11SocketDir {
+			env["DISPLAY"] = s.X11Display
+		} else {
+			missing = append(missing, X11SocketDir)
+		}
+	}
+	if len(s.XAuthority) > 0 {
+		if cookie, ok := MapHostPath(paths, s.XAuthority); ok {
+			env["XAUTHORITY"] = cookie
+		} else {
+			missing = append(missing, s.XAuthority)
+		}
+	}
+	//libwayland accepts an absolute socket path since 1.15, so the
+	//XDG_RUNTIME_DIR of the container is left alone
+	if len(s.WaylandSocket) > 0 {
+		if socket, ok := MapHostPath(paths, s.WaylandSocket); ok {
+			env["WAYLAND_DISPLAY"] = socket
+		} else {
+			missing = append(missing, s.WaylandSocket)
+		}
+	}
+
+	if len(missing) > 0 {
+		return env, fmt.Errorf("The display of the session is not shared with %s (%s), share it with: usdk-target autofix display",
+			info.Name, strings.Join(missing, ", "))
+	}
+	return env, nil
+}
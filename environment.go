@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"strings"
+	"regexp"
+)
+
+var EnvAllowConfig string = "user.usdk-env-allow"
+var EnvDenyConfig string = "user.usdk-env-deny"
+var LocaleConfig string = "user.usdk-locale"
+
+//entries ending with a * match all variables starting with the prefix
+var DefaultEnvAllow = []string{
+	"CMAKE_*",
+	"CCACHE_*",
+	"QT_*",
+	"QML_*",
+	"QML2_*",
+	"MAKEFLAGS",
+	"DEB_BUILD_OPTIONS",
+}
+
+//variables that would break the environment inside the container,
+//the deny list always wins over the allow list
+var DefaultEnvDeny = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"PWD",
+	"OLDPWD",
+	"SHLVL",
+	"LD_*",
+}
+
+//QtCreator needs the C locale to parse the compiler output
+var DefaultLocale = "C"
+
+//setting the locale to this value keeps LC_ALL untouched
+var LocaleNone = "none"
+
+var validEnvName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+func IsValidEnvName (name string) bool {
+	return validEnvName.MatchString(name)
+}
+
+type EnvPolicy struct {
+	Allow []string
+	Deny []string
+	Locale string
+}
+
+func splitEnvList (list string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+//NewEnvPolicy creates the environment policy of a target, the lists
+//from the container config are added to the default ones
+func NewEnvPolicy (config map[string]string) *EnvPolicy {
+	policy := &EnvPolicy{
+		Allow: append([]string{}, DefaultEnvAllow...),
+		Deny: append([]string{}, DefaultEnvDeny...),
+		Locale: DefaultLocale,
+	}
+
+	if allow, ok := config[EnvAllowConfig]; ok {
+		policy.Allow = append(policy.Allow, splitEnvList(allow)...)
+	}
+	if deny, ok := config[EnvDenyConfig]; ok {
+		policy.Deny = append(policy.Deny, splitEnvList(deny)...)
+	}
+	//the host cache directory does not exist inside the target
+	if CCacheEnabled(config) {
+		policy.Deny = append(policy.Deny, "CCACHE_DIR")
+	}
+	if locale, ok := config[LocaleConfig]; ok && len(locale) > 0 {
+		policy.Locale = locale
+	}
+
+	return policy
+}
+
+func matchesEnvList (name string, list []string) bool {
+	for _, entry := range list {
+		if strings.HasSuffix(entry, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(entry, "*")) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
+
+//Allows returns true if the variable should be forwarded into the target
+func (p *EnvPolicy) Allows (name string) bool {
+	return matchesEnvList(name, p.Allow) && !matchesEnvList(name, p.Deny)
+}
+
+//Environment filters environ (in the form of os.Environ) and returns
+//the variables that should be set inside the target
+func (p *EnvPolicy) Environment (environ []string) map[string]string {
+	env := map[string]string{}
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !IsValidEnvName(parts[0]) || !p.Allows(parts[0]) {
+			continue
+		}
+		env[parts[0]] = parts[1]
+	}
+
+	if p.Locale != LocaleNone {
+		env["LC_ALL"] = p.Locale
+	}
+	return env
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"strings"
+	"github.com/lxc/lxd/shared"
+)
+
+//ErrNoAccess is returned when the container backend can not be reached,
+//usually because LXD is not running or the user lacks permissions
+type ErrNoAccess struct {
+	Err error
+}
+
+func (e *ErrNoAccess) Error() string {
+	return fmt.Sprintf("Could not access the container backend. error: %v", e.Err)
+}
+
+//ErrNeedsFixing is returned when the container backend or a container
+//is in a state that can be repaired with usdk-target autofix
+type ErrNeedsFixing struct {
+	Err error
+}
+
+func (e *ErrNeedsFixing) Error() string {
+	return fmt.Sprintf("The container backend needs to be fixed. error: %v", e.Err)
+}
+
+//ErrNoBridge is returned when there is no usable network bridge
+type ErrNoBridge struct {
+	Err error
+}
+
+func (e *ErrNoBridge) Error() string {
+	return fmt.Sprintf("No usable LXD bridge found. error: %v", e.Err)
+}
+
+//ErrNotFound is returned when a container does not exist
+type ErrNotFound struct {
+	Container string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("Container %s not found", e.Container)
+}
+
+//isNotFound checks if a error returned by LXD means the object does not exist
+func isNotFound (err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+//ErrTimeout is returned when an operation did not finish in time
+type ErrTimeout struct {
+	Operation string
+}
+
+func (e *ErrTimeout) Error() string {
+	return fmt.Sprintf("Timed out while %s", e.Operation)
+}
+
+//ErrCanceled is returned when an operation was canceled, e.g. by Ctrl-C
+type ErrCanceled struct {
+	Operation string
+}
+
+func (e *ErrCanceled) Error() string {
+	return fmt.Sprintf("Canceled while %s", e.Operation)
+}
+
+//ErrNoSpace is returned when the storage of LXD does not have enough
+//free space left
+type ErrNoSpace struct {
+	Storage string
+	Free int64
+	Required int64
+}
+
+func (e *ErrNoSpace) Error() string {
+	return fmt.Sprintf("Not enough free space in %s, %s are free but %s are required",
+		e.Storage, shared.GetByteSizeString(e.Free), shared.GetByteSizeString(e.Required))
+}
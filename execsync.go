@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"github.com/lxc/lxd"
+)
+
+type ExecResult struct {
+	Code int
+	Stdout string
+	Stderr string
+}
+
+//ExecError is returned when a command in a container did not succeed,
+//it carries the captured output to explain what went wrong
+type ExecError struct {
+	Command []string
+	Result *ExecResult
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("Command '%s' failed with exit code %d", strings.Join(e.Command, " "), e.Result.Code)
+	if out := strings.TrimSpace(e.Result.Stderr); len(out) > 0 {
+		msg += "\nstderr: "+out
+	}
+	if out := strings.TrimSpace(e.Result.Stdout); len(out) > 0 {
+		msg += "\nstdout: "+out
+	}
+	return msg
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (*bufferCloser) Close() error {
+	return nil
+}
+
+//ExecSync runs a command as root in a running container without a
+//terminal, and returns its exit code together with the captured output
+func ExecSync (client *lxd.Client, container string, command []string) (*ExecResult, error) {
+	var stdout, stderr bufferCloser
+
+	code, err := client.Exec(container,
+		command,
+		map[string]string{},
+		ioutil.NopCloser(bytes.NewReader(nil)),
+		&stdout,
+		&stderr,
+		nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecResult{
+		Code: code,
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}, nil
+}
+
+//ExecSyncChecked works like ExecSync, but returns an ExecError if the
+//command exited with a non zero exit code
+func ExecSyncChecked (client *lxd.Client, container string, command []string) (*ExecResult, error) {
+	res, err := ExecSync(client, container, command)
+	if err != nil {
+		return nil, fmt.Errorf("Could not execute '%s'. error: %v", strings.Join(command, " "), err)
+	}
+	if res.Code != 0 {
+		return res, &ExecError{Command: command, Result: res}
+	}
+	return res, nil
+}
+
+//ForwardSignals delivers SIGTERM, SIGINT and SIGHUP to the process group
+//of the command that wrote its PID into pidfile inside the container,
+//until LXD supports sending signals to processes this is the only way
+func ForwardSignals (client *lxd.Client, container string, pidfile string) {
+	go func () {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+		for {
+			sig := <-ch
+			client.Exec(container, []string{
+				"/bin/bash",
+				"-c",
+				fmt.Sprintf("kill -%d -$(ps -o pgid= `cat %s` | grep -o '[0-9]*')", sig, pidfile),
+			}, map[string]string{}, ioutil.NopCloser(bytes.NewReader(nil)), nil, nil, nil, 0, 0)
+		}
+	} ()
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//AudioFixable shares the PulseAudio and PipeWire sockets of the calling
+//session with the targets that have audio enabled, and removes them from
+//the ones that do not
+type AudioFixable struct { }
+
+func (c *AudioFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	if !ubuntu_sdk_tools.AudioEnabled(container.ExpandedConfig) {
+		for devName := range container.Devices {
+			if !strings.HasPrefix(devName, ubuntu_sdk_tools.AudioDevicePrefix) {
+				continue
+			}
+
+			if !doFix {
+				return fmt.Errorf("Audio is disabled for %s, but the sound server is still shared", container.Name)
+			}
+
+			err := ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	//the sockets of a previous session might be gone
+	err := removeStaleDevices(ctx, client, container, ubuntu_sdk_tools.AudioDevicePrefix, doFix)
+	if err != nil {
+		return err
+	}
+
+	//the sockets move e.g. when switching from PulseAudio to PipeWire
+	for _, socket := range ubuntu_sdk_tools.FindAudioSockets(os.Environ()) {
+		dev, ok := container.Devices[socket.Device]
+		if ok && socket.Shared(dev) {
+			continue
+		}
+
+		if !doFix {
+			if ok {
+				return fmt.Errorf("The audio socket of %s has moved from %s to %s", container.Name, dev["source"], socket.Source)
+			}
+			return fmt.Errorf("The audio socket %s is not shared with %s", socket.Source, container.Name)
+		}
+
+		if ok {
+			err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, socket.Device)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name, socket.Device, "disk", socket.Props())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *AudioFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *AudioFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *AudioFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *AudioFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*AudioFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*AudioFixable) ID () string {
+	return "audio"
+}
+
+func (*AudioFixable) Description () string {
+	return "Shares the PulseAudio or PipeWire socket of the calling session with targets that have audio enabled"
+}
+
+func (*AudioFixable) DependsOn () []string {
+	return nil
+}
+
+func (*AudioFixable) Applies () bool {
+	return true
+}
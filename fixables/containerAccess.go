@@ -18,6 +18,7 @@
 package fixables
 
 import (
+	"context"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd"
 	"os"
@@ -27,11 +28,11 @@ import (
 )
 
 type ContainerAccess struct { }
-func (*ContainerAccess) run(client *lxd.Client, container string, doFix bool) error {
+func (*ContainerAccess) run(ctx context.Context, client *lxd.Client, container string, doFix bool) error {
 	targetPath := shared.VarPath("containers", container)
 	fi, err := os.Lstat(targetPath)
 	if err != nil {
-		return fmt.Errorf("Failed to query container access permissions\n",err)
+		return fmt.Errorf("Failed to query container access permissions. error: %v.\n",err)
 	}
 
 	if fi.Mode() & os.ModeSymlink == os.ModeSymlink {
@@ -42,7 +43,7 @@ func (*ContainerAccess) run(client *lxd.Client, container string, doFix bool) er
 
 		fi, err = os.Lstat(targetPath)
 		if err != nil {
-			return fmt.Errorf("Failed to query container access permissions\n",err)
+			return fmt.Errorf("Failed to query container access permissions. error: %v.\n",err)
 		}
 	}
 
@@ -60,51 +61,63 @@ func (*ContainerAccess) run(client *lxd.Client, container string, doFix bool) er
 	return nil
 }
 
-func (c *ContainerAccess) CheckContainer(client *lxd.Client, container string) error {
-	return c.run(client, container, false)
+func (c *ContainerAccess) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	return c.run(ctx, client, container, false)
 }
 
-func (c *ContainerAccess) FixContainer(client *lxd.Client, container string) error {
-	return c.run(client, container, true)
+func (c *ContainerAccess) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	return c.run(ctx, client, container, true)
 }
 
-func (c *ContainerAccess) Check(client *lxd.Client) error {
+func (c *ContainerAccess) Check(ctx context.Context, client *lxd.Client) error {
 
-	fmt.Println("Checking if containers are accessible")
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
 		return err
 	}
 
 	for _, target := range targets {
-		err := c.run(client, target.Name, false)
+		err := c.run(ctx, client, target.Name, false)
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("All containers are accessible.")
 	return nil
 }
 
-func (c *ContainerAccess) Fix(client *lxd.Client) error {
-	fmt.Println("Fixing possible container permission problems....")
+func (c *ContainerAccess) Fix(ctx context.Context, client *lxd.Client) error {
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
 		return err
 	}
 
 	for _, target := range targets {
-		err := c.run(client, target.Name, true)
+		err := c.run(ctx, client, target.Name, true)
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("All containers are accessible.")
 	return nil
 }
 
 func (*ContainerAccess) NeedsRoot () bool {
 	return true
 }
+
+func (*ContainerAccess) ID () string {
+	return "container-access"
+}
+
+func (*ContainerAccess) Description () string {
+	return "Makes the container directories readable, so the rootfs can be used by the IDE"
+}
+
+func (*ContainerAccess) DependsOn () []string {
+	return nil
+}
+
+func (*ContainerAccess) Applies () bool {
+	return true
+}
@@ -18,22 +18,65 @@
 package fixables
 
 import (
+	"context"
 	"github.com/lxc/lxd"
 	"launchpad.net/ubuntu-sdk-tools"
 	"fmt"
 	"os"
 	"github.com/lxc/lxd/shared"
+	"strings"
 )
 
 type DevicesFixable struct { }
 
-func (*DevicesFixable) run(client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+//checkProjectMount validates a project directory added by usdk-target mount,
+//the device name has to match the source so it can be found again
+func (*DevicesFixable) checkProjectMount(ctx context.Context, client *lxd.Client, container, devName string, dev shared.Device, doFix bool) error {
+	source := dev["source"]
+	if _, err := os.Stat(source); os.IsNotExist(err) {
+		if !doFix {
+			return fmt.Errorf("Shared project directory %s does not exist on the host.", source)
+		}
+		fmt.Fprintf(ubuntu_sdk_tools.InfoOutput, "Removing the shared project directory %s, it does not exist anymore.\n", source)
+		return ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container, devName)
+	}
+
+	if devName == ubuntu_sdk_tools.ProjectMountName(source) {
+		return nil
+	}
+
+	if !doFix {
+		return fmt.Errorf("Shared project directory %s has an unexpected device name %s.", source, devName)
+	}
+
+	err := ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container, devName)
+	if err != nil {
+		return err
+	}
+	_, err = ubuntu_sdk_tools.AddProjectMount(ctx, client, container, source, dev["path"], shared.IsTrue(dev["readonly"]))
+	return err
+}
+
+func (c *DevicesFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
 
 	for devName, dev := range container.Devices {
 		var toCheck string = ""
 		switch dev["type"] {
 		case "disk":
 			toCheck,_ = dev["source"]
+
+			//home and /tmp are repaired instead of removed by the mounts fixable
+			if devName == ubuntu_sdk_tools.TmpDeviceName || strings.HasPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix) {
+				continue
+			}
+
+			if strings.HasPrefix(devName, ubuntu_sdk_tools.ProjectMountPrefix) {
+				err := c.checkProjectMount(ctx, client, container.Name, devName, dev, doFix)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 		case "unix-char":
 			_, hasMaj := dev["major"]
 			_, hasMin := dev["minor"]
@@ -52,7 +95,7 @@ func (*DevicesFixable) run(client *lxd.Client, container *shared.ContainerInfo,
 		if len(toCheck) > 0 {
 			if _, err := os.Stat(toCheck); os.IsNotExist(err) {
 				if doFix {
-					err = ubuntu_sdk_tools.RemoveDeviceSync(client, container.Name, devName)
+					err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
 					if err != nil {
 						return err
 					}
@@ -65,26 +108,25 @@ func (*DevicesFixable) run(client *lxd.Client, container *shared.ContainerInfo,
 	return nil
 }
 
-func (c *DevicesFixable) CheckContainer(client *lxd.Client, container string) error {
+func (c *DevicesFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
 	info, err := client.ContainerInfo(container)
 	if err != nil {
 		return err
 	}
 
-	return c.run(client, info, false)
+	return c.run(ctx, client, info, false)
 }
 
-func (c *DevicesFixable) FixContainer(client *lxd.Client, container string) error {
+func (c *DevicesFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
 	info, err := client.ContainerInfo(container)
 	if err != nil {
 		return err
 	}
 
-	return c.run(client, info, true)
+	return c.run(ctx, client, info, true)
 }
 
-func (c *DevicesFixable) Check(client *lxd.Client) error {
-	fmt.Printf("Checking for broken devices...\n")
+func (c *DevicesFixable) Check(ctx context.Context, client *lxd.Client) error {
 
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
@@ -92,22 +134,21 @@ func (c *DevicesFixable) Check(client *lxd.Client) error {
 	}
 
 	for _, target := range targets {
-		err = c.run(client, &target.Container, false)
+		err = c.run(ctx, client, &target.Container, false)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
-func (c *DevicesFixable) Fix(client *lxd.Client) error {
-	fmt.Println("Checking for and removing broken devices....")
+func (c *DevicesFixable) Fix(ctx context.Context, client *lxd.Client) error {
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
 		return err
 	}
 
 	for _, target := range targets {
-		err = c.run(client, &target.Container, true)
+		err = c.run(ctx, client, &target.Container, true)
 		if err != nil {
 			return err
 		}
@@ -117,4 +158,20 @@ func (c *DevicesFixable) Fix(client *lxd.Client) error {
 
 func (*DevicesFixable) NeedsRoot () bool {
 	return false
-}
\ No newline at end of file
+}
+
+func (*DevicesFixable) ID () string {
+	return "devices"
+}
+
+func (*DevicesFixable) Description () string {
+	return "Removes devices whose source does not exist on the host anymore"
+}
+
+func (*DevicesFixable) DependsOn () []string {
+	return nil
+}
+
+func (*DevicesFixable) Applies () bool {
+	return true
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//DisplayFixable shares the X11 or Wayland display of the calling session
+//with the targets, paths that are already reachable e.g. through /tmp or
+//the home directory are not shared again
+type DisplayFixable struct { }
+
+func (c *DisplayFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	//the sockets of a previous session might be gone
+	err := removeStaleDevices(ctx, client, container, ubuntu_sdk_tools.DisplayDevicePrefix, doFix)
+	if err != nil {
+		return err
+	}
+
+	session := ubuntu_sdk_tools.NewDisplaySession(os.Environ())
+	paths := ubuntu_sdk_tools.SharedPaths(container)
+
+	hostPaths := session.HostPaths()
+	devNames := []string{}
+	for devName := range hostPaths {
+		devNames = append(devNames, devName)
+	}
+	sort.Strings(devNames)
+
+	for _, devName := range devNames {
+		hostPath := hostPaths[devName]
+		props := ubuntu_sdk_tools.DisplayDeviceProps(devName, hostPath)
+
+		dev, ok := container.Devices[devName]
+		if ok && ubuntu_sdk_tools.SameDevice(dev, ubuntu_sdk_tools.DeviceFromProps("disk", props)) {
+			continue
+		}
+
+		if mapped, reachable := ubuntu_sdk_tools.MapHostPath(paths, hostPath); !ok && reachable {
+			//the clients expect the X11 sockets in a fixed location
+			if hostPath != ubuntu_sdk_tools.X11SocketDir || mapped == hostPath {
+				continue
+			}
+		}
+
+		if !doFix {
+			return fmt.Errorf("%s is not shared with %s", hostPath, container.Name)
+		}
+
+		if ok {
+			err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name, devName, "disk", props)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DisplayFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *DisplayFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *DisplayFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DisplayFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*DisplayFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*DisplayFixable) ID () string {
+	return "display"
+}
+
+func (*DisplayFixable) Description () string {
+	return "Shares the X11 or Wayland display of the calling session with the targets"
+}
+
+//the display files might already be reachable through /tmp or the home directories
+func (*DisplayFixable) DependsOn () []string {
+	return []string{"mounts"}
+}
+
+//there is nothing to share if not called from a graphical session
+func (*DisplayFixable) Applies () bool {
+	return ubuntu_sdk_tools.NewDisplaySession(os.Environ()).HasDisplay()
+}
@@ -17,12 +17,22 @@
  */
 package fixables
 
-import "github.com/lxc/lxd"
+import (
+	"context"
+	"github.com/lxc/lxd"
+)
 
 type Fixable interface {
-	Check(client *lxd.Client) error
-	Fix(client *lxd.Client) error
-	CheckContainer(client *lxd.Client, container string) error
-	FixContainer(client *lxd.Client, container string) error
+	//ID is the stable name used to address the fixable on the command line
+	ID() string
+	Description() string
+	//DependsOn returns the ids of the fixables that have to run first
+	DependsOn() []string
+	//Applies reports whether the fixable is relevant on this host
+	Applies() bool
+	Check(ctx context.Context, client *lxd.Client) error
+	Fix(ctx context.Context, client *lxd.Client) error
+	CheckContainer(ctx context.Context, client *lxd.Client, container string) error
+	FixContainer(ctx context.Context, client *lxd.Client, container string) error
 	NeedsRoot() bool
 }
@@ -0,0 +1,238 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//Mesa packages providing the DRI drivers
+var mesaPackages = []string{"libgl1-mesa-dri", "libegl1-mesa"}
+
+//GPUFixable shares the DRI card and render nodes of the host GPUs with
+//the targets and reports targets without Mesa drivers
+type GPUFixable struct { }
+
+//hasMesa looks for the Mesa DRI drivers in the container, in the
+//multiarch directories as well as in /usr/lib/dri
+func (*GPUFixable) hasMesa (client *lxd.Client, container string) (bool, error) {
+	dirs := []string{"/usr/lib/dri"}
+
+	libs, err := ubuntu_sdk_tools.ListContainerDir(client, container, "/usr/lib")
+	if err != nil {
+		return false, err
+	}
+	for _, lib := range libs {
+		if strings.Contains(lib, "-linux-gnu") {
+			dirs = append(dirs, path.Join("/usr/lib", lib, "dri"))
+		}
+	}
+
+	for _, dir := range dirs {
+		drivers, err := ubuntu_sdk_tools.ListContainerDir(client, container, dir)
+		if err != nil {
+			return false, err
+		}
+		for _, driver := range drivers {
+			if strings.HasSuffix(driver, "_dri.so") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (c *GPUFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	nodes, err := ubuntu_sdk_tools.GPUDeviceNodes()
+	if err != nil {
+		return err
+	}
+
+	groups, err := ubuntu_sdk_tools.ContainerGroups(client, container.Name)
+	if err != nil {
+		return err
+	}
+
+	users := []string{}
+	for devName := range container.Devices {
+		if strings.HasPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix) {
+			users = append(users, strings.TrimPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix))
+		}
+	}
+	sort.Strings(users)
+
+	//the registered users need to be members of the groups owning the nodes
+	missingMembers := map[string][]string{}
+
+	for _, node := range nodes {
+		group, err := ubuntu_sdk_tools.GPUNodeGroup(node, groups)
+		if err != nil {
+			return fmt.Errorf("Can not share %s with %s. error: %v", node, container.Name, err)
+		}
+
+		for _, userName := range users {
+			if !shared.StringInSlice(userName, group.Members) && !shared.StringInSlice(userName, missingMembers[group.Name]) {
+				missingMembers[group.Name] = append(missingMembers[group.Name], userName)
+			}
+		}
+
+		gid := fmt.Sprintf("%d", group.Gid)
+		dev, ok := container.Devices[node]
+		if ok && dev["type"] == "unix-char" && dev["gid"] == gid {
+			continue
+		}
+
+		if !doFix {
+			if !ok {
+				return fmt.Errorf("Container is missing device node: %s", node)
+			}
+			return fmt.Errorf("Device node %s is not owned by the group %s in %s", node, group.Name, container.Name)
+		}
+
+		if ok {
+			err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, node)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name,
+			node, "unix-char",
+			[]string{fmt.Sprintf("path=%s", node[1:]), fmt.Sprintf("gid=%s", gid), "mode=0660"},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	//installing Mesa needs the network, which would make creating a
+	//target fail without one, so missing drivers are only reported
+	if len(nodes) > 0 {
+		hasMesa, err := c.hasMesa(client, container.Name)
+		if err != nil {
+			return err
+		}
+		if !hasMesa {
+			fmt.Fprintf(os.Stderr, "No Mesa DRI drivers found in %s, install %s to use the GPU.\n", container.Name, strings.Join(mesaPackages, " "))
+		}
+	}
+
+	if !doFix {
+		for groupName, members := range missingMembers {
+			return fmt.Errorf("The users %s are not members of the group %s in %s", strings.Join(members, ", "), groupName, container.Name)
+		}
+		return nil
+	}
+
+	if len(missingMembers) == 0 {
+		return nil
+	}
+
+	err = ubuntu_sdk_tools.BootContainerSync(ctx, client, container.Name)
+	if err != nil {
+		return err
+	}
+
+	for groupName, members := range missingMembers {
+		for _, userName := range members {
+			_, err = ubuntu_sdk_tools.ExecSyncChecked(client, container.Name, []string{"usermod", "--append", "--groups", groupName, userName})
+			if err != nil {
+				return fmt.Errorf("Could not add %s to the group %s. error: %v", userName, groupName, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *GPUFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *GPUFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *GPUFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *GPUFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*GPUFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*GPUFixable) ID () string {
+	return "gpu"
+}
+
+func (*GPUFixable) Description () string {
+	return "Shares the DRI card and render nodes of the host GPUs with the targets and reports missing Mesa drivers"
+}
+
+//the registered users have to exist before they can be added to the groups
+func (*GPUFixable) DependsOn () []string {
+	return []string{"devices", "registered-users"}
+}
+
+func (c *GPUFixable) Applies () bool {
+	nodes, err := ubuntu_sdk_tools.GPUDeviceNodes()
+	return err == nil && len(nodes) > 0
+}
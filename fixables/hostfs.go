@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//hostFS gives the fixables access to the host filesystem, so the detection
+//logic can be run against a fake filesystem
+type hostFS interface {
+	ReadFile (name string) ([]byte, error)
+	Exists (name string) bool
+	Glob (pattern string) ([]string, error)
+}
+
+//osFS is the hostFS of the running system
+type osFS struct { }
+
+func (osFS) ReadFile (name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (osFS) Exists (name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func (osFS) Glob (pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
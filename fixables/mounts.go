@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type MountsFixable struct { }
+
+//diskMatches checks if the disk device shares dir under the same path
+func (*MountsFixable) diskMatches(dev shared.Device, dir string) bool {
+	return dev["type"] == "disk" &&
+		filepath.Clean(dev["source"]) == filepath.Clean(dir) &&
+		filepath.Clean(dev["path"]) == filepath.Clean(dir)
+}
+
+//replaceDisk removes the device if it exists and adds it again
+func (*MountsFixable) replaceDisk(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, devName string, props []string) error {
+	if _, ok := container.Devices[devName]; ok {
+		err := ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+		if err != nil {
+			return err
+		}
+	}
+	return ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name, devName, "disk", props)
+}
+
+func (c *MountsFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	tmpDev, ok := container.Devices[ubuntu_sdk_tools.TmpDeviceName]
+	if !ok || !c.diskMatches(tmpDev, "/tmp") {
+		if !doFix {
+			return fmt.Errorf("/tmp of the host is not shared with %s", container.Name)
+		}
+
+		err := c.replaceDisk(ctx, client, container, ubuntu_sdk_tools.TmpDeviceName, ubuntu_sdk_tools.TmpDeviceProps())
+		if err != nil {
+			return err
+		}
+	}
+
+	for devName, dev := range container.Devices {
+		if !strings.HasPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix) {
+			continue
+		}
+
+		userName := strings.TrimPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix)
+		pw, err := ubuntu_sdk_tools.Getpwnam(userName)
+		if err != nil {
+			if !doFix {
+				return fmt.Errorf("The registered user %s of %s does not exist on the host", userName, container.Name)
+			}
+
+			fmt.Fprintf(ubuntu_sdk_tools.InfoOutput, "Removing the home directory of %s, the user does not exist anymore.\n", userName)
+			err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if c.diskMatches(dev, pw.Dir) {
+			continue
+		}
+
+		if !doFix {
+			return fmt.Errorf("The home directory of %s in %s is %s, but should be %s", userName, container.Name, dev["source"], pw.Dir)
+		}
+
+		err = c.replaceDisk(ctx, client, container, devName, ubuntu_sdk_tools.HomeDeviceProps(pw.Dir))
+		if err != nil {
+			return err
+		}
+
+		//the user inside the container has to use the new location as well
+		err = ubuntu_sdk_tools.BootContainerSync(ctx, client, container.Name)
+		if err != nil {
+			return err
+		}
+
+		command := []string{"usermod", "--home", pw.Dir, userName}
+		res, err := ubuntu_sdk_tools.ExecSync(client, container.Name, command)
+		if err != nil {
+			return err
+		}
+
+		//exit code 6 means the user does not exist in the container
+		if res.Code != 0 && res.Code != 6 {
+			return fmt.Errorf("Could not update the home directory of %s in %s. error: %v", userName, container.Name,
+				&ubuntu_sdk_tools.ExecError{Command: command, Result: res})
+		}
+	}
+	return nil
+}
+
+func (c *MountsFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *MountsFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *MountsFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *MountsFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*MountsFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*MountsFixable) ID () string {
+	return "mounts"
+}
+
+func (*MountsFixable) Description () string {
+	return "Makes sure /tmp and the home directories of the registered users are shared with the targets"
+}
+
+func (*MountsFixable) DependsOn () []string {
+	return nil
+}
+
+func (*MountsFixable) Applies () bool {
+	return true
+}
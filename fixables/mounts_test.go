@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"testing"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//a target that shares /tmp already must not be touched, the nil client
+//makes any attempt to change the devices fail
+func TestMountsKeepsSharedTmp (t *testing.T) {
+	m := &MountsFixable{}
+	info := &shared.ContainerInfo{
+		Name: "target",
+		Devices: shared.Devices{
+			ubuntu_sdk_tools.TmpDeviceName: ubuntu_sdk_tools.DeviceFromProps("disk", ubuntu_sdk_tools.TmpDeviceProps()),
+		},
+	}
+
+	if err := m.run(context.Background(), nil, info, false); err != nil {
+		t.Errorf("check failed on a shared /tmp: %v", err)
+	}
+	if err := m.run(context.Background(), nil, info, true); err != nil {
+		t.Errorf("fix failed on a shared /tmp: %v", err)
+	}
+}
+
+func TestMountsReportsMissingTmp (t *testing.T) {
+	m := &MountsFixable{}
+	info := &shared.ContainerInfo{
+		Name: "target",
+		Devices: shared.Devices{
+			ubuntu_sdk_tools.TmpDeviceName: shared.Device{"type": "disk", "source": "/var/tmp", "path": "/tmp"},
+		},
+	}
+
+	if err := m.run(context.Background(), nil, info, false); err == nil {
+		t.Errorf("check accepted a /tmp that is not shared from the host")
+	}
+
+	delete(info.Devices, ubuntu_sdk_tools.TmpDeviceName)
+	if err := m.run(context.Background(), nil, info, false); err == nil {
+		t.Errorf("check accepted a target without /tmp")
+	}
+}
+
+func TestSameDevice (t *testing.T) {
+	tmp := ubuntu_sdk_tools.DeviceFromProps("disk", ubuntu_sdk_tools.TmpDeviceProps())
+
+	tests := []struct {
+		name string
+		dev shared.Device
+		want bool
+	}{
+		{name: "identical", dev: shared.Device{"type": "disk", "source": "/tmp", "path": "/tmp", "recursive": "true"}, want: true},
+		{name: "different source", dev: shared.Device{"type": "disk", "source": "/var/tmp", "path": "/tmp", "recursive": "true"}, want: false},
+		{name: "missing property", dev: shared.Device{"type": "disk", "source": "/tmp", "path": "/tmp"}, want: false},
+		{name: "different type", dev: shared.Device{"type": "unix-char", "source": "/tmp", "path": "/tmp", "recursive": "true"}, want: false},
+	}
+
+	for _, test := range tests {
+		if got := ubuntu_sdk_tools.SameDevice(tmp, test.dev); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
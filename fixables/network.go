@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type NetworkFixable struct { }
+
+//preferredBridge picks the bridge broken nics are attached to, the one
+//created by autosetup wins over the others
+func (*NetworkFixable) preferredBridge(bridges []string) string {
+	if shared.StringInSlice(ubuntu_sdk_tools.SdkBridgeName, bridges) {
+		return ubuntu_sdk_tools.SdkBridgeName
+	}
+	return bridges[0]
+}
+
+func (c *NetworkFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	//a missing networks API or bridge is reported by the bridge check of
+	//initialized, which can be skipped, e.g. on hosts with an unmanaged
+	//bridge, there is nothing to compare with
+	bridges, err := ubuntu_sdk_tools.UsableBridges(client)
+	if err != nil || len(bridges) == 0 {
+		if doFix {
+			fmt.Fprintf(os.Stderr, "Not checking the network devices of %s, no usable LXD bridge was found.\n", container.Name)
+		}
+		return nil
+	}
+
+	//the devices of the profiles are included in the expanded devices
+	names := []string{}
+	for devName := range container.ExpandedDevices {
+		names = append(names, devName)
+	}
+	sort.Strings(names)
+
+	for _, devName := range names {
+		dev := container.ExpandedDevices[devName]
+		if dev["type"] != "nic" || dev["nictype"] != "bridged" {
+			continue
+		}
+
+		if shared.StringInSlice(dev["parent"], bridges) {
+			continue
+		}
+
+		if !doFix {
+			return fmt.Errorf("The network device %s of %s is attached to %s, which is not a usable LXD bridge", devName, container.Name, dev["parent"])
+		}
+
+		bridge := c.preferredBridge(bridges)
+
+		//a local device overrides the one from the profile with the same
+		//name, so only devices of the container itself have to be removed
+		if _, ok := container.Devices[devName]; ok {
+			err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+			if err != nil {
+				return err
+			}
+		}
+
+		props := []string{}
+		for key, val := range dev {
+			if key == "type" || key == "parent" {
+				continue
+			}
+			props = append(props, fmt.Sprintf("%s=%s", key, val))
+		}
+		props = append(props, fmt.Sprintf("parent=%s", bridge))
+		sort.Strings(props)
+
+		err = ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name, devName, "nic", props)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *NetworkFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *NetworkFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *NetworkFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *NetworkFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*NetworkFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*NetworkFixable) ID () string {
+	return "network"
+}
+
+func (*NetworkFixable) Description () string {
+	return "Attaches network devices pointing to missing or unmanaged bridges to a usable LXD bridge"
+}
+
+func (*NetworkFixable) DependsOn () []string {
+	return nil
+}
+
+func (*NetworkFixable) Applies () bool {
+	return true
+}
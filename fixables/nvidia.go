@@ -18,181 +18,329 @@
 package fixables
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"path/filepath"
-	"github.com/lxc/lxd"
-	"launchpad.net/ubuntu-sdk-tools"
 	"os"
-	"io/ioutil"
+	"path"
+	"path/filepath"
 	"regexp"
-	"github.com/lxc/lxd/shared"
+	"runtime"
+	"sort"
 	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
 )
 
 var driverVerFile    = "/sys/module/nvidia/version"
 var driverDirName    = "nv-bin"
 var versionPattern   = regexp.MustCompile("^([0-9]+).*$")
 
-var globNvDir *string = nil
+//libraries of libglvnd/multiarch installs are shared one by one with this prefix
+const driverLibPrefix = "nv-lib-"
+
+//the libglvnd vendor files are shared with this prefix, without them
+//libglvnd does not load the libraries of the driver
+const driverVendorPrefix = "nv-vendor-"
+var glvndVendorPattern = "/usr/share/glvnd/egl_vendor.d/*nvidia*.json"
 
-type NvidiaFixable struct { }
+//the directory the driver libraries are mounted to inside the container
+const containerDriverDir = "/usr/lib/nvidia-gl"
+
+//ldconfig config registering containerDriverDir in the container
+const ldConfFile = "/etc/ld.so.conf.d/01-nvidia.conf"
+
+//multiarch directories of the host, by architecture
+var multiarchDirs = map[string]string{
+	"amd64": "/usr/lib/x86_64-linux-gnu",
+	"386": "/usr/lib/i386-linux-gnu",
+	"arm64": "/usr/lib/aarch64-linux-gnu",
+	"arm": "/usr/lib/arm-linux-gnueabihf",
+	"ppc64le": "/usr/lib/powerpc64le-linux-gnu",
+}
 
-func (*NvidiaFixable) findNvidiaDir ( ) (*string, error) {
-	if (globNvDir != nil) {
-		return globNvDir, nil
+//libraries installed by the driver next to the system libraries, they are
+//suffixed with the full driver version
+var driverLibPatterns = []string{
+	"libnvidia-*.so.%s",
+	"libGLX_nvidia.so.%s",
+	"libEGL_nvidia.so.%s",
+	"libGLESv1_CM_nvidia.so.%s",
+	"libGLESv2_nvidia.so.%s",
+	"libcuda.so.%s",
+	"libnvcuvid.so.%s",
+	"libGL.so.%s",
+}
+
+//nvidiaDriver describes the driver currently loaded on the host
+type nvidiaDriver struct {
+	Version string
+	//devices the container needs to use the driver, by device name
+	Devices shared.Devices
+}
+
+type NvidiaFixable struct {
+	fs hostFS
+}
+
+func (c *NvidiaFixable) host () hostFS {
+	if c.fs == nil {
+		return osFS{}
+	}
+	return c.fs
+}
+
+//findNvidiaDriver returns the driver loaded on the host, or nil if there is
+//none or its libraries can not be found
+func findNvidiaDriver (fs hostFS, arch string) (*nvidiaDriver, error) {
+	//we have no nvidia module loaded if this file does not exist
+	if !fs.Exists(driverVerFile) {
+		return nil, nil
 	}
 
-	verBytes, err := ioutil.ReadFile(driverVerFile)
+	verBytes, err := fs.ReadFile(driverVerFile)
 	if err != nil {
 		return nil, err
 	}
 
-	verString := strings.TrimSpace(string(verBytes))
-	parts := versionPattern.FindStringSubmatch(verString)
+	version := strings.TrimSpace(string(verBytes))
+	parts := versionPattern.FindStringSubmatch(version)
 	if len(parts) == 0 {
 		return nil, nil
 	}
 
+	driver := &nvidiaDriver{
+		Version: version,
+		Devices: shared.Devices{},
+	}
+
+	//old packages install into their own directory, which is shared as a whole
 	nvidiaDir := fmt.Sprintf("/usr/lib/nvidia-%s", parts[1])
-	if _, err := os.Stat(nvidiaDir); os.IsNotExist(err) {
-		fmt.Printf("Nvidia dir %s does not exist\n", nvidiaDir)
+	if fs.Exists(nvidiaDir) {
+		driver.Devices[driverDirName] = shared.Device{
+			"type": "disk",
+			"source": nvidiaDir,
+			"path": containerDriverDir,
+			"recursive": "true",
+		}
+	} else if libDir, ok := multiarchDirs[arch]; ok {
+		//libglvnd based packages install next to the system libraries
+		for _, pattern := range driverLibPatterns {
+			libs, err := fs.Glob(filepath.Join(libDir, fmt.Sprintf(pattern, version)))
+			if err != nil {
+				return nil, err
+			}
+			for _, lib := range libs {
+				driver.Devices[driverLibPrefix+path.Base(lib)] = shared.Device{
+					"type": "disk",
+					"source": lib,
+					"path": path.Join(containerDriverDir, path.Base(lib)),
+				}
+			}
+		}
+
+		if len(driver.Devices) > 0 {
+			vendors, err := fs.Glob(glvndVendorPattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, vendor := range vendors {
+				driver.Devices[driverVendorPrefix+path.Base(vendor)] = shared.Device{
+					"type": "disk",
+					"source": vendor,
+					"path": vendor,
+				}
+			}
+		}
+	}
+
+	if len(driver.Devices) == 0 {
 		return nil, nil
 	}
 
-	globNvDir = &nvidiaDir
-	return globNvDir, nil
+	nodes, err := fs.Glob("/dev/nvidia*")
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		driver.Devices[node] = shared.Device{
+			"type": "unix-char",
+			"path": node[1:],
+			"gid": "44",
+		}
+	}
+	return driver, nil
 }
 
-func (c *NvidiaFixable) run(client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
-	//we have no nvidia module loaded if this file does not exist
-	if _, err := os.Stat(driverVerFile); os.IsNotExist(err) {
-		return nil
+//isNvidiaDevice returns true for all devices managed by the NvidiaFixable
+func isNvidiaDevice (name string) bool {
+	return name == driverDirName ||
+		strings.HasPrefix(name, driverLibPrefix) ||
+		strings.HasPrefix(name, driverVendorPrefix) ||
+		strings.HasPrefix(name, "/dev/nvidia")
+}
+
+//diffNvidiaDevices compares the devices of a container with the ones the
+//driver needs, devices that are outdated show up in both lists
+func diffNvidiaDevices (current shared.Devices, driver *nvidiaDriver) (remove []string, add []string) {
+	wanted := shared.Devices{}
+	if driver != nil {
+		wanted = driver.Devices
 	}
 
-	dir, err := c.findNvidiaDir()
+	for name, dev := range current {
+		if !isNvidiaDevice(name) {
+			continue
+		}
+		if want, ok := wanted[name]; !ok || !ubuntu_sdk_tools.SameDevice(dev, want) {
+			remove = append(remove, name)
+		}
+	}
+
+	for name, want := range wanted {
+		if dev, ok := current[name]; !ok || !ubuntu_sdk_tools.SameDevice(dev, want) {
+			add = append(add, name)
+		}
+	}
+
+	sort.Strings(remove)
+	sort.Strings(add)
+	return remove, add
+}
+
+//ldConfOutdated returns true if the ldconfig config of the container does not
+//match the state of the driver
+func ldConfOutdated (fs hostFS, container string, driver *nvidiaDriver) bool {
+	confPath := filepath.Join(ubuntu_sdk_tools.ContainerRootfs(container), ldConfFile)
+	if driver == nil {
+		return fs.Exists(confPath)
+	}
+
+	//the rootfs of privileged containers is only readable by root, in that
+	//case the file can not be checked, which is not an error
+	content, err := fs.ReadFile(confPath)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return strings.TrimSpace(string(content)) != containerDriverDir
+}
+
+//updateLDConf writes or removes the ldconfig config through LXD and
+//refreshes the linker cache in the container
+func (c *NvidiaFixable) updateLDConf (ctx context.Context, client *lxd.Client, container string, driver *nvidiaDriver) error {
+	err := ubuntu_sdk_tools.BootContainerSync(ctx, client, container)
 	if err != nil {
 		return err
 	}
 
-	if dir == nil {
-		return nil
+	if driver == nil {
+		_, err = ubuntu_sdk_tools.ExecSyncChecked(client, container, []string{"rm", "-f", ldConfFile})
+	} else {
+		err = client.PushFile(container, ldConfFile, 0, 0, "0644", bytes.NewReader([]byte(containerDriverDir+"\n")))
+	}
+	if err != nil {
+		return fmt.Errorf("Could not update %s in %s. error: %v", ldConfFile, container, err)
 	}
 
-	files, err := filepath.Glob("/dev/nvidia*")
+	_, err = ubuntu_sdk_tools.ExecSyncChecked(client, container, []string{"ldconfig"})
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not update the linker cache in %s. error: %v", container, err)
 	}
+	return nil
+}
 
+func (c *NvidiaFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	driver, err := findNvidiaDriver(c.host(), runtime.GOARCH)
+	if err != nil {
+		return err
+	}
 
-	needToAddDriverDir := false
-	if container.Devices.ContainsName(driverDirName) {
-		if container.Devices[driverDirName]["source"] != *dir {
-			if !doFix {
-				return fmt.Errorf("NVidia Binary directory is not pointing to the currently used one")
-			}
+	remove, add := diffNvidiaDevices(container.Devices, driver)
+	//without the driver the config is removed together with the devices,
+	//as other users than root can not see it in the rootfs
+	updateConf := ldConfOutdated(c.host(), container.Name, driver) || (driver == nil && len(remove) > 0)
 
-			//device needs update, remove it and add back later
-			err = ubuntu_sdk_tools.RemoveDeviceSync(client, container.Name, driverDirName)
-			if err != nil {
-				return err
+	if !doFix {
+		if len(remove) > 0 || len(add) > 0 {
+			if driver == nil {
+				return fmt.Errorf("NVidia devices are shared, but the host has no NVidia driver anymore")
 			}
-			needToAddDriverDir = true
+			return fmt.Errorf("NVidia driver or device nodes are not shared with the container")
 		}
-	} else {
-		if !doFix {
-			return fmt.Errorf("NVidia Binary directory is not mounted")
+		if updateConf {
+			return fmt.Errorf("Need to update the nvidia loader config file")
 		}
-		needToAddDriverDir = true
+		return nil
 	}
 
-	if (doFix && needToAddDriverDir) {
-		err = ubuntu_sdk_tools.AddDeviceSync(
-			client, container.Name,
-			driverDirName, "disk",
-			[]string{fmt.Sprintf("source=%s", *dir), "path=/usr/lib/nvidia-gl", "recursive=true"},
-		)
+	for _, name := range remove {
+		err = ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, name)
 		if err != nil {
 			return err
 		}
 	}
 
-	ldLoaderFile := shared.VarPath("containers", container.Name, "rootfs","etc","ld.so.conf.d","01-nvidia.conf")
-	needToWriteLDConf := false
-	if _, err := os.Stat(ldLoaderFile); os.IsNotExist(err) {
-		needToWriteLDConf = true
-	}
-
-	if needToWriteLDConf {
-		if !doFix {
-			return fmt.Errorf("Need to write the nvidia loader config file")
+	for _, name := range add {
+		props := []string{}
+		for key, val := range driver.Devices[name] {
+			if key != "type" {
+				props = append(props, fmt.Sprintf("%s=%s", key, val))
+			}
 		}
-		fmt.Printf("Writing ld.conf file.\n")
-		err = ioutil.WriteFile(ldLoaderFile, []byte("/usr/lib/nvidia-gl\n"),0664)
+		sort.Strings(props)
+
+		err = ubuntu_sdk_tools.AddDeviceSync(ctx, client, container.Name, name, driver.Devices[name]["type"], props)
 		if err != nil {
 			return err
 		}
 	}
 
-	for _,node := range files {
-		if !container.Devices.ContainsName(node) {
-			if !doFix {
-				return fmt.Errorf("Missing NVidia device")
-			}
-
-			err = ubuntu_sdk_tools.AddDeviceSync(
-				client, container.Name,
-				node, "unix-char",
-				[]string{fmt.Sprintf("path=%s", node[1:]),"gid=44"},
-			)
-			if err != nil {
-				return err
-			}
-		}
+	if updateConf {
+		return c.updateLDConf(ctx, client, container.Name, driver)
 	}
 	return nil
 }
-
-func (c *NvidiaFixable) CheckContainer(client *lxd.Client, container string) error {
+func (c *NvidiaFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
 	info, err := client.ContainerInfo(container)
 	if err != nil {
 		return err
 	}
 
-	return c.run(client, info, false)
+	return c.run(ctx, client, info, false)
 }
 
-func (c *NvidiaFixable) FixContainer(client *lxd.Client, container string) error {
+func (c *NvidiaFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
 	info, err := client.ContainerInfo(container)
 	if err != nil {
 		return err
 	}
 
-	return c.run(client, info, true)
+	return c.run(ctx, client, info, true)
 }
 
-func (c *NvidiaFixable) Check(client *lxd.Client) error {
+func (c *NvidiaFixable) Check(ctx context.Context, client *lxd.Client) error {
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
 		return err
 	}
 
 	for _, target := range targets {
-		err = c.run(client, &target.Container, false)
+		err = c.run(ctx, client, &target.Container, false)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
-func (c *NvidiaFixable) Fix(client *lxd.Client) error {
-	fmt.Println("Fixing possible NVidia issues....")
+func (c *NvidiaFixable) Fix(ctx context.Context, client *lxd.Client) error {
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
 	if err != nil {
 		return err
 	}
 
 	for _, target := range targets {
-		err = c.run(client, &target.Container, true)
+		err = c.run(ctx, client, &target.Container, true)
 		if err != nil {
 			return err
 		}
@@ -204,3 +352,20 @@ func (*NvidiaFixable) NeedsRoot () bool {
 	return false
 }
 
+func (*NvidiaFixable) ID () string {
+	return "nvidia"
+}
+
+func (*NvidiaFixable) Description () string {
+	return "Shares the NVidia driver and device nodes of the host with the containers"
+}
+
+func (*NvidiaFixable) DependsOn () []string {
+	return []string{"devices"}
+}
+
+//Applies also when the driver is gone, so leftovers can be cleaned up,
+//run does nothing if the devices of a target are up to date
+func (*NvidiaFixable) Applies () bool {
+	return true
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//fakeFS is a hostFS backed by a map of file names to contents
+type fakeFS map[string]string
+
+func (f fakeFS) ReadFile (name string) ([]byte, error) {
+	content, ok := f[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+func (f fakeFS) Exists (name string) bool {
+	for file := range f {
+		if file == name || strings.HasPrefix(file, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fakeFS) Glob (pattern string) ([]string, error) {
+	matches := []string{}
+	for file := range f {
+		if ok, err := filepath.Match(pattern, file); err != nil {
+			return nil, err
+		} else if ok {
+			matches = append(matches, file)
+		}
+	}
+	return matches, nil
+}
+
+//deniedFS fails to read any file like the rootfs of a privileged
+//container does for other users than root
+type deniedFS struct {
+	fakeFS
+}
+
+func (deniedFS) ReadFile (name string) ([]byte, error) {
+	return nil, os.ErrPermission
+}
+
+func legacyDevices () shared.Devices {
+	return shared.Devices{
+		"nv-bin": shared.Device{"type": "disk", "source": "/usr/lib/nvidia-361", "path": "/usr/lib/nvidia-gl", "recursive": "true"},
+		"/dev/nvidia0": shared.Device{"type": "unix-char", "path": "dev/nvidia0", "gid": "44"},
+	}
+}
+
+func TestFindNvidiaDriver (t *testing.T) {
+	tests := []struct {
+		name string
+		fs fakeFS
+		arch string
+		want []string
+	}{
+		{
+			name: "no driver loaded",
+			fs: fakeFS{"/usr/lib/nvidia-361/libGL.so.1": ""},
+			arch: "amd64",
+			want: nil,
+		},
+		{
+			name: "invalid version",
+			fs: fakeFS{driverVerFile: "unknown\n"},
+			arch: "amd64",
+			want: nil,
+		},
+		{
+			name: "driver without libraries",
+			fs: fakeFS{driverVerFile: "361.42\n", "/dev/nvidia0": ""},
+			arch: "amd64",
+			want: nil,
+		},
+		{
+			name: "legacy layout",
+			fs: fakeFS{
+				driverVerFile: "361.42\n",
+				"/usr/lib/nvidia-361/libGL.so.1": "",
+				"/dev/nvidia0": "",
+				"/dev/nvidiactl": "",
+			},
+			arch: "amd64",
+			want: []string{"/dev/nvidia0", "/dev/nvidiactl", "nv-bin"},
+		},
+		{
+			name: "multiarch layout",
+			fs: fakeFS{
+				driverVerFile: "535.113.01\n",
+				"/usr/lib/x86_64-linux-gnu/libGLX_nvidia.so.535.113.01": "",
+				"/usr/lib/x86_64-linux-gnu/libnvidia-glcore.so.535.113.01": "",
+				"/usr/lib/x86_64-linux-gnu/libnvidia-glcore.so.470.42": "",
+				"/usr/lib/x86_64-linux-gnu/libc.so.6": "",
+				"/usr/lib/i386-linux-gnu/libGLX_nvidia.so.535.113.01": "",
+				"/usr/share/glvnd/egl_vendor.d/10_nvidia.json": "",
+				"/usr/share/glvnd/egl_vendor.d/50_mesa.json": "",
+				"/dev/nvidia0": "",
+			},
+			arch: "amd64",
+			want: []string{"/dev/nvidia0", "nv-lib-libGLX_nvidia.so.535.113.01", "nv-lib-libnvidia-glcore.so.535.113.01", "nv-vendor-10_nvidia.json"},
+		},
+		{
+			name: "multiarch layout of another architecture",
+			fs: fakeFS{
+				driverVerFile: "535.113.01\n",
+				"/usr/lib/x86_64-linux-gnu/libGLX_nvidia.so.535.113.01": "",
+			},
+			arch: "arm64",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		driver, err := findNvidiaDriver(test.fs, test.arch)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		var got []string = nil
+		if driver != nil {
+			got = []string{}
+			for name := range driver.Devices {
+				got = append(got, name)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got devices %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindNvidiaDriverLibraryDevice (t *testing.T) {
+	fs := fakeFS{
+		driverVerFile: "535.113.01\n",
+		"/usr/lib/x86_64-linux-gnu/libEGL_nvidia.so.535.113.01": "",
+	}
+
+	driver, err := findNvidiaDriver(fs, "amd64")
+	if err != nil || driver == nil {
+		t.Fatalf("expected a driver, got %v, %v", driver, err)
+	}
+
+	want := shared.Device{
+		"type": "disk",
+		"source": "/usr/lib/x86_64-linux-gnu/libEGL_nvidia.so.535.113.01",
+		"path": "/usr/lib/nvidia-gl/libEGL_nvidia.so.535.113.01",
+	}
+	if got := driver.Devices["nv-lib-libEGL_nvidia.so.535.113.01"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDiffNvidiaDevices (t *testing.T) {
+	upgraded := legacyDevices()
+	upgraded["nv-bin"] = shared.Device{"type": "disk", "source": "/usr/lib/nvidia-367", "path": "/usr/lib/nvidia-gl", "recursive": "true"}
+
+	withOthers := legacyDevices()
+	withOthers["tmp"] = shared.Device{"type": "disk", "source": "/tmp", "path": "/tmp"}
+	withOthers["/dev/dri/card0"] = shared.Device{"type": "unix-char", "path": "dev/dri/card0"}
+
+	tests := []struct {
+		name string
+		current shared.Devices
+		driver *nvidiaDriver
+		remove []string
+		add []string
+	}{
+		{
+			name: "up to date",
+			current: legacyDevices(),
+			driver: &nvidiaDriver{Devices: legacyDevices()},
+		},
+		{
+			name: "nothing shared yet",
+			current: shared.Devices{},
+			driver: &nvidiaDriver{Devices: legacyDevices()},
+			add: []string{"/dev/nvidia0", "nv-bin"},
+		},
+		{
+			name: "driver upgraded",
+			current: legacyDevices(),
+			driver: &nvidiaDriver{Devices: upgraded},
+			remove: []string{"nv-bin"},
+			add: []string{"nv-bin"},
+		},
+		{
+			name: "driver removed",
+			current: withOthers,
+			driver: nil,
+			remove: []string{"/dev/nvidia0", "nv-bin"},
+		},
+		{
+			name: "switched to multiarch layout",
+			current: shared.Devices{
+				"nv-bin": legacyDevices()["nv-bin"],
+				"nv-lib-libGL.so.1": shared.Device{"type": "disk", "source": "/usr/lib/x86_64-linux-gnu/libGL.so.1", "path": "/usr/lib/nvidia-gl/libGL.so.1"},
+			},
+			driver: &nvidiaDriver{Devices: shared.Devices{
+				"nv-lib-libGL.so.1": shared.Device{"type": "disk", "source": "/usr/lib/x86_64-linux-gnu/libGL.so.1", "path": "/usr/lib/nvidia-gl/libGL.so.1"},
+			}},
+			remove: []string{"nv-bin"},
+		},
+	}
+
+	for _, test := range tests {
+		remove, add := diffNvidiaDevices(test.current, test.driver)
+		if fmt.Sprint(remove) != fmt.Sprint(test.remove) || fmt.Sprint(add) != fmt.Sprint(test.add) {
+			t.Errorf("%s: got remove %v add %v, want remove %v add %v", test.name, remove, add, test.remove, test.add)
+		}
+	}
+}
+
+func TestLDConfOutdated (t *testing.T) {
+	confPath := filepath.Join(ubuntu_sdk_tools.ContainerRootfs("target"), ldConfFile)
+	driver := &nvidiaDriver{Devices: legacyDevices()}
+
+	tests := []struct {
+		name string
+		fs hostFS
+		driver *nvidiaDriver
+		want bool
+	}{
+		{name: "missing", fs: fakeFS{}, driver: driver, want: true},
+		{name: "up to date", fs: fakeFS{confPath: "/usr/lib/nvidia-gl\n"}, driver: driver, want: false},
+		{name: "wrong directory", fs: fakeFS{confPath: "/usr/lib/nvidia-361\n"}, driver: driver, want: true},
+		{name: "leftover", fs: fakeFS{confPath: "/usr/lib/nvidia-gl\n"}, driver: nil, want: true},
+		{name: "no driver", fs: fakeFS{}, driver: nil, want: false},
+		{name: "unreadable", fs: deniedFS{fakeFS{confPath: "/usr/lib/nvidia-gl\n"}}, driver: driver, want: false},
+	}
+
+	for _, test := range tests {
+		if got := ldConfOutdated(test.fs, "target", test.driver); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"fmt"
+)
+
+//all known fixables, in the order they were registered
+var registry = []Fixable{}
+
+//ids of fixables that were merged into others, so scripts keep working
+var aliases = map[string]string{
+	"dri": "gpu",
+}
+
+func init() {
+	Register(&ContainerAccess{})
+	Register(&DevicesFixable{})
+	Register(&MountsFixable{})
+	Register(&RegisteredUsersFixable{})
+	Register(&GPUFixable{})
+	Register(&NvidiaFixable{})
+	Register(&ToolFarmFixable{})
+	Register(&NetworkFixable{})
+	Register(&DisplayFixable{})
+	Register(&AudioFixable{})
+}
+
+//Register adds a fixable to the registry, ids have to be unique
+func Register (fixable Fixable) {
+	if _, ok := Lookup(fixable.ID()); ok {
+		panic(fmt.Sprintf("Fixable %s registered twice", fixable.ID()))
+	}
+	registry = append(registry, fixable)
+}
+
+func Lookup (id string) (Fixable, bool) {
+	if target, ok := aliases[id]; ok {
+		id = target
+	}
+	for _, fixable := range registry {
+		if fixable.ID() == id {
+			return fixable, true
+		}
+	}
+	return nil, false
+}
+
+//All returns all registered fixables, ordered so that each one comes
+//after its dependencies
+func All () ([]Fixable, error) {
+	return Resolve(nil)
+}
+
+//Resolve returns the fixables with the given ids together with their
+//dependencies in the order they have to run, if ids is empty all
+//registered fixables are returned
+func Resolve (ids []string) ([]Fixable, error) {
+	if len(ids) == 0 {
+		for _, fixable := range registry {
+			ids = append(ids, fixable.ID())
+		}
+	}
+
+	ordered := []Fixable{}
+	state := map[string]int{}
+
+	const (
+		visiting = 1
+		done = 2
+	)
+
+	var visit func (id string, requiredBy string) error
+	visit = func (id string, requiredBy string) error {
+		fixable, ok := Lookup(id)
+		if !ok {
+			if len(requiredBy) > 0 {
+				return fmt.Errorf("Unknown fixable %s, required by %s", id, requiredBy)
+			}
+			return fmt.Errorf("Unknown fixable %s", id)
+		}
+
+		//aliases resolve to the same fixable
+		id = fixable.ID()
+		switch state[id] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("Fixable %s has a circular dependency", id)
+		}
+
+		state[id] = visiting
+		for _, dep := range fixable.DependsOn() {
+			if err := visit(dep, id); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+
+		ordered = append(ordered, fixable)
+		return nil
+	}
+
+	for _, id := range ids {
+		if err := visit(id, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"testing"
+)
+
+func TestResolveAlias (t *testing.T) {
+	fixableSet, err := Resolve([]string{"dri", "gpu"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	count := 0
+	for _, fixable := range fixableSet {
+		if fixable.ID() == "gpu" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected the gpu fixable once, got it %d times", count)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//removeStaleDevices removes the disk devices with the prefix whose source
+//does not exist anymore, e.g. the sockets of a session that ended
+func removeStaleDevices (ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, prefix string, doFix bool) error {
+	devNames := []string{}
+	for devName := range container.Devices {
+		if strings.HasPrefix(devName, prefix) {
+			devNames = append(devNames, devName)
+		}
+	}
+	sort.Strings(devNames)
+
+	for _, devName := range devNames {
+		source := container.Devices[devName]["source"]
+		if _, err := os.Stat(source); !os.IsNotExist(err) {
+			continue
+		}
+
+		if !doFix {
+			return fmt.Errorf("%s shared with %s does not exist anymore", source, container.Name)
+		}
+
+		err := ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container.Name, devName)
+		if err != nil {
+			return err
+		}
+		delete(container.Devices, devName)
+		delete(container.ExpandedDevices, devName)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"github.com/lxc/lxd"
+	"launchpad.net/ubuntu-sdk-tools"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type ToolFarmFixable struct { }
+
+func (*ToolFarmFixable) run(ctx context.Context, client *lxd.Client, container string, doFix bool) error {
+	//the tool links live in the home of the user, running as root
+	//without knowing the user would create them in the wrong place
+	if os.Getuid() == 0 && ubuntu_sdk_tools.InvokingUser() == nil {
+		return nil
+	}
+
+	//targets without a tool farm are fine, the links are created with
+	//usdk-target tools install
+	links, err := ubuntu_sdk_tools.ListToolFarm(container)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	broken := []string{}
+	for _, link := range links {
+		if link.Broken {
+			broken = append(broken, link.Name)
+		}
+	}
+
+	if len(broken) == 0 {
+		return nil
+	}
+
+	if !doFix {
+		return fmt.Errorf("The tool links %s of %s in %s are broken", strings.Join(broken, ", "), container, ubuntu_sdk_tools.ToolFarmDir(container))
+	}
+
+	_, err = ubuntu_sdk_tools.RepairToolFarm(container)
+	return err
+}
+
+func (c *ToolFarmFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	return c.run(ctx, client, container, false)
+}
+
+func (c *ToolFarmFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	return c.run(ctx, client, container, true)
+}
+
+func (c *ToolFarmFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, target.Name, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ToolFarmFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, target.Name, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*ToolFarmFixable) NeedsRoot () bool {
+	return false
+}
+
+func (*ToolFarmFixable) ID () string {
+	return "tool-farm"
+}
+
+func (*ToolFarmFixable) Description () string {
+	return "Repairs broken links to the target tools used by the IDE"
+}
+
+func (*ToolFarmFixable) DependsOn () []string {
+	return nil
+}
+
+func (*ToolFarmFixable) Applies () bool {
+	//without knowing the user the links can not be created
+	return os.Getuid() != 0 || ubuntu_sdk_tools.InvokingUser() != nil
+}
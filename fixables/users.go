@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package fixables
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//RegisteredUsersFixable makes sure every user with a home directory device
+//exists in the container, e.g. after the rootfs was reset, the groups are
+//created like usdk-target register does without -g
+type RegisteredUsersFixable struct { }
+
+func (*RegisteredUsersFixable) run(ctx context.Context, client *lxd.Client, container *shared.ContainerInfo, doFix bool) error {
+	for devName := range container.Devices {
+		if !strings.HasPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix) {
+			continue
+		}
+
+		//users removed from the host are handled by the mounts fixable
+		userName := strings.TrimPrefix(devName, ubuntu_sdk_tools.HomeDevicePrefix)
+		if _, err := ubuntu_sdk_tools.Getpwnam(userName); err != nil {
+			continue
+		}
+
+		exists, err := ubuntu_sdk_tools.ContainerHasUser(client, container.Name, userName)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if !doFix {
+			return fmt.Errorf("The registered user %s does not exist in %s", userName, container.Name)
+		}
+
+		err = ubuntu_sdk_tools.BootContainerSync(ctx, client, container.Name)
+		if err != nil {
+			return err
+		}
+
+		err = ubuntu_sdk_tools.CreateUserInContainer(client, container.Name, userName, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RegisteredUsersFixable) CheckContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, false)
+}
+
+func (c *RegisteredUsersFixable) FixContainer(ctx context.Context, client *lxd.Client, container string) error {
+	info, err := client.ContainerInfo(container)
+	if err != nil {
+		return err
+	}
+
+	return c.run(ctx, client, info, true)
+}
+
+func (c *RegisteredUsersFixable) Check(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RegisteredUsersFixable) Fix(ctx context.Context, client *lxd.Client) error {
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = c.run(ctx, client, &target.Container, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//reading the password hash of the user requires root
+func (*RegisteredUsersFixable) NeedsRoot () bool {
+	return true
+}
+
+func (*RegisteredUsersFixable) ID () string {
+	return "registered-users"
+}
+
+func (*RegisteredUsersFixable) Description () string {
+	return "Recreates registered users missing in the targets"
+}
+
+func (*RegisteredUsersFixable) DependsOn () []string {
+	return []string{"container-access", "mounts"}
+}
+
+func (*RegisteredUsersFixable) Applies () bool {
+	return true
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+//the group the device nodes are owned by inside the container if the
+//group of the host does not exist there, e.g. render in older images
+const fallbackGPUGroup = "video"
+
+//GPUDeviceNodes returns the DRI card and render nodes of the host GPUs
+func GPUDeviceNodes () ([]string, error) {
+	nodes := []string{}
+	for _, pattern := range []string{"/dev/dri/card*", "/dev/dri/renderD*"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, files...)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+//GPUNodeGroup finds the group in the container that should own the
+//node, the host group is used if the container knows it
+func GPUNodeGroup (node string, groups []GroupEntry) (*GroupEntry, error) {
+	fi, err := os.Stat(node)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if hostGroup, err := user.LookupGroupId(fmt.Sprintf("%d", st.Gid)); err == nil {
+			names = append(names, hostGroup.Name)
+		}
+	}
+	names = append(names, fallbackGPUGroup)
+
+	for _, name := range names {
+		for idx := range groups {
+			if groups[idx].Name == name {
+				return &groups[idx], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("The container has none of the groups %s", strings.Join(names, ", "))
+}
+
+//GPUGroups returns the groups of the container owning the GPU device
+//nodes, users need to be members to use the GPU
+func GPUGroups (client *lxd.Client, container string) ([]string, error) {
+	nodes, err := GPUDeviceNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := ContainerGroups(client, container)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, node := range nodes {
+		//nodes without a group are reported by the gpu fixable
+		group, err := GPUNodeGroup(node, groups)
+		if err != nil {
+			continue
+		}
+		if !shared.StringInSlice(group.Name, names) {
+			names = append(names, group.Name)
+		}
+	}
+	return names, nil
+}
@@ -24,13 +24,14 @@
 package ubuntu_sdk_tools
 
 import (
+	"context"
 	"github.com/lxc/lxd"
 	"github.com/lxc/lxd/shared"
 	"path"
 	"os"
 	"fmt"
+	"io"
 	"log"
-	"os/exec"
 	"strings"
 )
 
@@ -46,8 +47,15 @@ type ClickContainer struct {
 	Container shared.ContainerInfo `json:"-"`
 }
 
-func EnsureLXDInitializedOrDie() {
-	config := GetConfigOrDie()
+//name of the remote the SDK images are downloaded from
+const ImageRemoteName = "ubuntu-sdk-images"
+
+//EnsureLXDInitialized registers the remote for the SDK images
+func EnsureLXDInitialized () error {
+	config, err := GetConfig()
+	if err != nil {
+		return err
+	}
 
 	//let's register a new remote
 	defaultImageRemote := "https://sdk-images.canonical.com"
@@ -55,61 +63,80 @@ func EnsureLXDInitializedOrDie() {
 		defaultImageRemote = os.Getenv("USDK_TEST_REMOTE")
 	}
 
-	defaultRemoteName  := "ubuntu-sdk-images"
 	remotes := config.Remotes
-	sdkRem, ok := remotes[defaultRemoteName]
+	sdkRem, ok := remotes[ImageRemoteName]
 	if ok {
 		if sdkRem.Addr == defaultImageRemote {
-			return
-		} else {
-			cmd := exec.Command("lxc", "remote", "remove", defaultRemoteName)
-			err := cmd.Run()
+			return nil
+		}
+
+		//drop the remote pointing to the wrong server, including its certificate
+		delete(config.Remotes, ImageRemoteName)
+		certf := config.ServerCertPath(ImageRemoteName)
+		if shared.PathExists(certf) {
+			err := os.Remove(certf)
 			if (err != nil) {
-				fmt.Fprintf(os.Stderr, "Could not remove the remote "+defaultRemoteName+". error: %v\n", err)
-				fmt.Fprintf(os.Stderr, "Please remove it manually.\n", err)
-				os.Exit(1)
+				return fmt.Errorf("Could not remove the certificate of the remote %s, please remove it manually. error: %v", ImageRemoteName, err)
 			}
 		}
 	}
 
-	cmd := exec.Command("lxc", "remote", "add", "ubuntu-sdk-images", defaultImageRemote, "--accept-certificate", "--protocol=simplestreams")
-	err := cmd.Run()
+	//simplestreams remotes are always public and do not use certificates
+	config.Remotes[ImageRemoteName] = lxd.RemoteConfig{
+		Addr: defaultImageRemote,
+		Public: true,
+		Protocol: "simplestreams",
+	}
+
+	err = lxd.SaveConfig(config, lxdConfigPath())
 	if (err != nil) {
-		fmt.Fprintf(os.Stderr, "Could not register remote. error: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("Could not register remote. error: %v", err)
 	}
 
 	//make sure config is loaded again
 	globConfig = nil
+	return nil
 }
 
-func GetConfigOrDie ()  (*lxd.Config) {
-
-	if globConfig != nil {
-		return globConfig
+func EnsureLXDInitializedOrDie() {
+	err := EnsureLXDInitialized()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
+}
 
+//lxdConfigPath returns the path of the LXD client configuration file
+func lxdConfigPath () string {
 	configDir := "$HOME/.config/lxc"
 	if os.Getenv("LXD_CONF") != "" {
 		configDir = os.Getenv("LXD_CONF")
 	}
-	configPath := os.ExpandEnv(path.Join(configDir, "config.yml"))
+	return os.ExpandEnv(path.Join(configDir, "config.yml"))
+}
 
-	globConfig, err := lxd.LoadConfig(configPath)
+//GetConfig loads the LXD client configuration, generating the client
+//certificates if required
+func GetConfig () (*lxd.Config, error) {
+
+	if globConfig != nil {
+		return globConfig, nil
+	}
+
+	config, err := lxd.LoadConfig(lxdConfigPath())
 	if err != nil {
-		log.Fatal("Could not load LXC config")
+		return nil, fmt.Errorf("Could not load LXC config. error: %v", err)
 	}
 
-	certf := globConfig.ConfigPath("client.crt")
-	keyf := globConfig.ConfigPath("client.key")
+	certf := config.ConfigPath("client.crt")
+	keyf := config.ConfigPath("client.key")
 
 	if !shared.PathExists(certf) || !shared.PathExists(keyf) {
 		fmt.Fprintf(os.Stderr, "Generating a client certificate. This may take a minute...\n")
 
 		err = shared.FindOrGenCert(certf, keyf)
 		if err != nil {
-			log.Fatal("Could not generate client certificates.\n")
-			os.Exit(1)
+			return nil, fmt.Errorf("Could not generate client certificates. error: %v", err)
 		}
 
 		if shared.PathExists("/var/lib/lxd/") {
@@ -117,11 +144,109 @@ func GetConfigOrDie ()  (*lxd.Config) {
 		}
 	}
 
-	return globConfig
+	globConfig = config
+	return globConfig, nil
 }
 
-func BootContainerSync (client *lxd.Client, name string) error {
-	current, err := client.ContainerInfo(name)
+func GetConfigOrDie ()  (*lxd.Config) {
+	config, err := GetConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return config
+}
+
+//NewClient connects to the given remote, or to the default remote
+//if remote is empty
+func NewClient (remote string) (*lxd.Client, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(remote) == 0 {
+		remote = config.DefaultRemote
+	}
+
+	client, err := lxd.NewClient(config, remote)
+	if err != nil {
+		return nil, &ErrNoAccess{Err: err}
+	}
+	return client, nil
+}
+
+//CheckBackend makes sure the LXD server can be talked to
+func CheckBackend (client *lxd.Client) error {
+	_, err := client.ServerStatus()
+	if err != nil {
+		return &ErrNoAccess{Err: err}
+	}
+	return nil
+}
+
+//name of the bridge created by usdk-target autosetup
+const SdkBridgeName = "sdkbr0"
+
+//UsableBridges returns the names of the managed bridges with a IPv4
+//subnet, which are required for the containers to reach the network
+func UsableBridges (client *lxd.Client) ([]string, error) {
+	netConfList, err := client.ListNetworks()
+	if err != nil {
+		return nil, &ErrNoAccess{Err: err}
+	}
+
+	bridges := []string{}
+	for _,netConf := range netConfList {
+		if !netConf.Managed || netConf.Type != "bridge" {
+			continue
+		}
+
+		if addr, ok := netConf.Config["ipv4.address"]; !ok || addr == "" || addr == "none" {
+			continue
+		}
+
+		bridges = append(bridges, netConf.Name)
+	}
+	return bridges, nil
+}
+
+//CheckLXDBridge makes sure there is a usable bridge
+func CheckLXDBridge (client *lxd.Client) (error) {
+	bridges, err := UsableBridges(client)
+	if err != nil {
+		return err
+	}
+
+	if len(bridges) == 0 {
+		return &ErrNoBridge{Err: fmt.Errorf("lxd-bridge not configured")}
+	}
+	return nil
+}
+
+//GetContainerInfo returns the configuration of the container, or
+//ErrNotFound if it does not exist
+func GetContainerInfo (client *lxd.Client, container string) (*shared.ContainerInfo, error) {
+	info, err := client.ContainerInfo(container)
+	if isNotFound(err) {
+		return nil, &ErrNotFound{Container: container}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func BootContainerSync (ctx context.Context, client *lxd.Client, name string) error {
+	operation := fmt.Sprintf("starting the container %s", name)
+
+	var current *shared.ContainerInfo
+	err := RunWithContext(ctx, operation, func () (err error) {
+		current, err = client.ContainerInfo(name)
+		return
+	})
+	if isNotFound(err) {
+		return &ErrNotFound{Container: name}
+	}
 	if err != nil {
 		return err
 	}
@@ -138,7 +263,11 @@ func BootContainerSync (client *lxd.Client, name string) error {
 	}
 
 
-	resp, err := client.Action(name, action, 10, false, false)
+	var resp *lxd.Response
+	err = RunWithContext(ctx, operation, func () (err error) {
+		resp, err = client.Action(name, action, 10, false, false)
+		return
+	})
 	if err != nil {
 		return err
 	}
@@ -147,20 +276,30 @@ func BootContainerSync (client *lxd.Client, name string) error {
 		return fmt.Errorf("bad result type from action")
 	}
 
-	if err := client.WaitForSuccess(resp.Operation); err != nil {
+	if err := WaitForOperation(ctx, client, resp.Operation, operation); err != nil {
 		return fmt.Errorf("%s\nTry `lxc info --show-log %s` for more info", err, name)
 	}
 	return nil
 }
 
-func StopContainerSync  (client *lxd.Client, container string) error {
-	ct, err := client.ContainerInfo(container)
+func StopContainerSync  (ctx context.Context, client *lxd.Client, container string) error {
+	operation := fmt.Sprintf("stopping the container %s", container)
+
+	var ct *shared.ContainerInfo
+	err := RunWithContext(ctx, operation, func () (err error) {
+		ct, err = client.ContainerInfo(container)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
 	if ct.StatusCode != 0 && ct.StatusCode != shared.Stopped {
-		resp, err := client.Action(container, shared.Stop, -1, true, false)
+		var resp *lxd.Response
+		err = RunWithContext(ctx, operation, func () (err error) {
+			resp, err = client.Action(container, shared.Stop, -1, true, false)
+			return
+		})
 		if err != nil {
 			return err
 		}
@@ -169,7 +308,7 @@ func StopContainerSync  (client *lxd.Client, container string) error {
 			return fmt.Errorf("bad result type from action")
 		}
 
-		if err := client.WaitForSuccess(resp.Operation); err != nil {
+		if err := WaitForOperation(ctx, client, resp.Operation, operation); err != nil {
 			return fmt.Errorf("%s\nTry `lxc info --show-log %s` for more info", err, container)
 		}
 
@@ -180,71 +319,125 @@ func StopContainerSync  (client *lxd.Client, container string) error {
 	return nil
 }
 
-func UpdateConfigSync (client *lxd.Client, container string) error {
-	fmt.Printf("Applying changes to container: %s\n", container)
-	err := StopContainerSync(client, container)
+func UpdateConfigSync (ctx context.Context, client *lxd.Client, container string) error {
+	fmt.Fprintf(InfoOutput, "Applying changes to container: %s\n", container)
+	err := StopContainerSync(ctx, client, container)
 	if err != nil {
 		return err
 	}
 
-	err = BootContainerSync(client, container)
+	err = BootContainerSync(ctx, client, container)
 	if ( err != nil ) {
 		return err
 	}
 
-	command := []string {
-		"exec", container, "--",
-		"bash", "-c", "rm /etc/ld.so.cache; ldconfig",
-	}
+	return RunWithContext(ctx, fmt.Sprintf("updating the linker cache of %s", container), func () error {
+		_, err := ExecSyncChecked(client, container, []string {
+			"bash", "-c", "rm /etc/ld.so.cache; ldconfig",
+		})
+		return err
+	})
+}
 
-	cmd := exec.Command("lxc", command...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+//DeviceFromProps returns the device LXD creates for the key=value props
+func DeviceFromProps (devtype string, props []string) shared.Device {
+	dev := shared.Device{"type": devtype}
+	for _, prop := range props {
+		parts := strings.SplitN(prop, "=", 2)
+		if len(parts) == 2 {
+			dev[parts[0]] = parts[1]
+		}
+	}
+	return dev
+}
 
-	return cmd.Run()
+//SameDevice returns true if both devices have the same properties
+func SameDevice (a, b shared.Device) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, val := range a {
+		if bVal, ok := b[key]; !ok || bVal != val {
+			return false
+		}
+	}
+	return true
 }
 
-func AddDeviceSync (client *lxd.Client, container, devname, devtype string, props []string) error{
-	fmt.Printf("Adding device %s to %s: %s %v\n",devname, container, devtype, props)
-	resp, err := client.ContainerDeviceAdd(container, devname, devtype, props)
+//AddDeviceSync adds a device to the container, adding a device that exists
+//already with the same properties does nothing, so fixables and commands
+//can both make sure a device is there
+func AddDeviceSync (ctx context.Context, client *lxd.Client, container, devname, devtype string, props []string) error{
+	var info *shared.ContainerInfo
+	err := RunWithContext(ctx, fmt.Sprintf("querying the devices of %s", container), func () (err error) {
+		info, err = client.ContainerInfo(container)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	if dev, ok := info.Devices[devname]; ok && SameDevice(dev, DeviceFromProps(devtype, props)) {
+		return nil
+	}
+
+	fmt.Fprintf(InfoOutput, "Adding device %s to %s: %s %v\n",devname, container, devtype, props)
+	operation := fmt.Sprintf("adding the device %s to %s", devname, container)
+
+	var resp *lxd.Response
+	err = RunWithContext(ctx, operation, func () (err error) {
+		resp, err = client.ContainerDeviceAdd(container, devname, devtype, props)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
-	err = client.WaitForSuccess(resp.Operation)
+	err = WaitForOperation(ctx, client, resp.Operation, operation)
 	if err == nil {
-		fmt.Printf("Device %s added to %s\n", devname, container)
+		fmt.Fprintf(InfoOutput, "Device %s added to %s\n", devname, container)
 	}
 	return err
 }
 
-func RemoveDeviceSync (client *lxd.Client, container, devname string) error{
-	fmt.Printf("Removing device %s\n",devname)
-	resp, err := client.ContainerDeviceDelete(container, devname)
+func RemoveDeviceSync (ctx context.Context, client *lxd.Client, container, devname string) error{
+	fmt.Fprintf(InfoOutput, "Removing device %s\n",devname)
+	operation := fmt.Sprintf("removing the device %s from %s", devname, container)
+
+	var resp *lxd.Response
+	err := RunWithContext(ctx, operation, func () (err error) {
+		resp, err = client.ContainerDeviceDelete(container, devname)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
-	err = client.WaitForSuccess(resp.Operation)
+	err = WaitForOperation(ctx, client, resp.Operation, operation)
 	if err == nil {
-		fmt.Printf("Device %s removed from %s\n", devname, container)
+		fmt.Fprintf(InfoOutput, "Device %s removed from %s\n", devname, container)
 	}
 	return err
 }
 
-func RemoveContainerSync(client *lxd.Client, container string) (error){
+func RemoveContainerSync(ctx context.Context, client *lxd.Client, container string) (error){
 
-	err := StopContainerSync(client, container)
+	err := StopContainerSync(ctx, client, container)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Delete(container)
+	operation := fmt.Sprintf("deleting the container %s", container)
+
+	var resp *lxd.Response
+	err = RunWithContext(ctx, operation, func () (err error) {
+		resp, err = client.Delete(container)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
-	return client.WaitForSuccess(resp.Operation)
+	return WaitForOperation(ctx, client, resp.Operation, operation)
 }
 
 func GetUserConfirmation(question string) (bool) {
@@ -259,8 +452,9 @@ func GetUserConfirmation(question string) (bool) {
 	for !ok {
 		fmt.Print(question+" (yes/no): ")
 		_, err := fmt.Scanln(&response)
-		if err != nil {
-			log.Fatal(err)
+		if err == io.EOF {
+			//nobody is there to answer
+			return false
 		}
 
 		response = strings.ToLower(response)
@@ -270,6 +464,27 @@ func GetUserConfirmation(question string) (bool) {
 	return answer
 }
 
+//prefix of the disk devices mounting the home directories of registered users
+const HomeDevicePrefix = "home_of_"
+
+//name of the disk device sharing /tmp with the host, usdk-wrapper relies
+//on it for its pidfiles
+const TmpDeviceName = "tmp"
+
+//HomeDeviceName returns the name of the disk device mounting the home
+//directory of a registered user
+func HomeDeviceName (userName string) string {
+	return HomeDevicePrefix + userName
+}
+
+func HomeDeviceProps (dir string) []string {
+	return []string{fmt.Sprintf("source=%s", dir), fmt.Sprintf("path=%s", dir), "recursive=true"}
+}
+
+func TmpDeviceProps () []string {
+	return []string{"source=/tmp", "path=/tmp", "recursive=true"}
+}
+
 func ContainerRootfs (container string) (string) {
 	return shared.VarPath("containers", container, "rootfs")
 }
@@ -278,6 +493,15 @@ var ClickArchConfig string = "user.click-architecture"
 var ClickFrameworkConfig string = "user.click-framework"
 var TargetUpgradesConfig string = "user.click-updates-enabled"
 
+//policy of usdk-wrapper for removing the cmake cache of a build directory
+var CMakeInvalidateConfig string = "user.usdk-cmake-invalidate"
+const (
+	//only when the cache was created for a different target or toolchain
+	CMakeInvalidateAuto = "auto"
+	CMakeInvalidateAlways = "always"
+	CMakeInvalidateNever = "never"
+)
+
 func FindClickTargets (client *lxd.Client) ([]ClickContainer, error) {
 	ctslist, err := client.ListContainers()
 	if err != nil {
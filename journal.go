@@ -0,0 +1,247 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//the build journal is opt-in, either per target or per environment
+var JournalConfig string = "user.usdk-journal"
+var JournalEnv = "USDK_JOURNAL"
+
+//number of invocations kept per target
+var JournalMaxEntries = 50
+
+type JournalEntry struct {
+	Id string `json:"id"`
+	Container string `json:"container"`
+	Tool string `json:"tool"`
+	Args []string `json:"args"`
+	Cwd string `json:"cwd"`
+	Start time.Time `json:"start"`
+	Duration float64 `json:"duration"`
+	ExitCode int `json:"exitCode"`
+}
+
+type JournalRecorder struct {
+	entry JournalEntry
+	mutex sync.Mutex
+	file *os.File
+	gz *gzip.Writer
+}
+
+func JournalEnabled (config map[string]string) bool {
+	return config[JournalConfig] == "true" || os.Getenv(JournalEnv) == "1"
+}
+
+func journalDir (container string) string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if len(dir) == 0 {
+		dir = os.ExpandEnv("$HOME/.cache")
+	}
+	return filepath.Join(dir, "ubuntu-sdk-tools", "history", container)
+}
+
+//NewJournalRecorder starts recording an invocation of tool in container
+func NewJournalRecorder (container, tool string, args []string, cwd string) (*JournalRecorder, error) {
+	start := time.Now()
+	rec := &JournalRecorder{
+		entry: JournalEntry{
+			Id: fmt.Sprintf("%d", start.UnixNano()),
+			Container: container,
+			Tool: tool,
+			Args: args,
+			Cwd: cwd,
+			Start: start,
+		},
+	}
+
+	dir := journalDir(container)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.file, err = os.OpenFile(filepath.Join(dir, rec.entry.Id+".log.gz"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	rec.gz = gzip.NewWriter(rec.file)
+	return rec, nil
+}
+
+//Write appends to the recorded output, it is safe to be used
+//for stdout and stderr at the same time
+func (r *JournalRecorder) Write (p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.gz.Write(p)
+}
+
+//Finish stores the result of the invocation and drops old entries
+func (r *JournalRecorder) Finish (exitCode int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.entry.ExitCode = exitCode
+	r.entry.Duration = time.Since(r.entry.Start).Seconds()
+
+	err := r.gz.Close()
+	if err != nil {
+		return err
+	}
+	err = r.file.Close()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r.entry)
+	if err != nil {
+		return err
+	}
+
+	dir := journalDir(r.entry.Container)
+	err = ioutil.WriteFile(filepath.Join(dir, r.entry.Id+".json"), data, 0600)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ListJournal(r.entry.Container)
+	if err != nil {
+		return err
+	}
+	for idx := JournalMaxEntries; idx < len(entries); idx++ {
+		_ = os.Remove(filepath.Join(dir, entries[idx].Id+".json"))
+		_ = os.Remove(filepath.Join(dir, entries[idx].Id+".log.gz"))
+	}
+	return nil
+}
+
+func readJournalDir (dir string) ([]JournalEntry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []JournalEntry{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping invalid journal entry %s. error: %v\n", file, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type journalByStart []JournalEntry
+
+func (s journalByStart) Len() int { return len(s) }
+func (s journalByStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s journalByStart) Less(i, j int) bool { return s[i].Start.After(s[j].Start) }
+
+//ListJournal returns the recorded invocations of a container, or of all
+//containers if it is empty, the most recent first
+func ListJournal (container string) ([]JournalEntry, error) {
+	dirs := []string{journalDir(container)}
+	if len(container) == 0 {
+		var err error
+		dirs, err = filepath.Glob(filepath.Join(journalDir(""), "*"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := []JournalEntry{}
+	for _, dir := range dirs {
+		dirEntries, err := readJournalDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirEntries...)
+	}
+
+	sort.Sort(journalByStart(entries))
+	return entries, nil
+}
+
+//FindJournalEntry looks up a recorded invocation by its id
+func FindJournalEntry (id string) (*JournalEntry, error) {
+	entries, err := ListJournal("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Id == id {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("No journal entry with id %s", id)
+}
+
+type journalOutput struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (o *journalOutput) Close() error {
+	o.Reader.Close()
+	return o.file.Close()
+}
+
+//OpenJournalOutput returns the recorded output of an invocation
+func OpenJournalOutput (entry *JournalEntry) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(journalDir(entry.Container), entry.Id+".log.gz"))
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &journalOutput{Reader: gz, file: file}, nil
+}
+
+//CommandLine returns the invocation as it could be typed into a shell
+func (e *JournalEntry) CommandLine () string {
+	parts := []string{QuoteString(filepath.Base(e.Tool))}
+	for _, arg := range e.Args {
+		parts = append(parts, QuoteString(arg))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//time without usdk-wrapper or exec use after which a target is stopped
+//by usdk-target reap, in the format of time.ParseDuration
+var IdleTimeoutConfig string = "user.usdk-idle-timeout"
+
+//interval in which long running commands refresh the last use
+var LastUseInterval = time.Minute
+
+func lastUseDir () string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(dir) == 0 {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("ubuntu-sdk-tools-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, "ubuntu-sdk-tools", "last-use")
+}
+
+//TouchLastUse records that the container was used right now
+func TouchLastUse (container string) error {
+	dir := lastUseDir()
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	stamp := filepath.Join(dir, container)
+	f, err := os.OpenFile(stamp, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	now := time.Now()
+	return os.Chtimes(stamp, now, now)
+}
+
+//LastUse returns when the container was used the last time, if the
+//container was never used by us it returns a zero time
+func LastUse (container string) (time.Time, error) {
+	fi, err := os.Stat(filepath.Join(lastUseDir(), container))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+//KeepAlive records the use of the container until the returned
+//function is called, this keeps long builds from being reaped
+func KeepAlive (container string) func() {
+	_ = TouchLastUse(container)
+
+	done := make(chan bool)
+	go func () {
+		ticker := time.NewTicker(LastUseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = TouchLastUse(container)
+			case <-done:
+				return
+			}
+		}
+	} ()
+
+	return func () {
+		close(done)
+		_ = TouchLastUse(container)
+	}
+}
+
+//IdleTimeout returns the idle timeout of a target, or 0 if it should
+//never be stopped automatically
+func IdleTimeout (config map[string]string) (time.Duration, error) {
+	value, ok := config[IdleTimeoutConfig]
+	if !ok || len(value) == 0 {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid idle timeout %s. error: %v", value, err)
+	}
+	return timeout, nil
+}
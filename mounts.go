@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+//disk devices added for project directories are named with this prefix
+const ProjectMountPrefix = "usdk_mount_"
+
+var unsafeDeviceChars = regexp.MustCompile("[^A-Za-z0-9_.-]")
+
+type SharedPath struct {
+	Device string `json:"device"`
+	Source string `json:"source"`
+	Path string `json:"path"`
+	ReadOnly bool `json:"readonly"`
+}
+
+//SharedPaths returns the host directories mounted into the container
+func SharedPaths (info *shared.ContainerInfo) []SharedPath {
+	paths := []SharedPath{}
+	for name, dev := range info.ExpandedDevices {
+		if dev["type"] != "disk" || len(dev["source"]) == 0 || len(dev["path"]) == 0 {
+			continue
+		}
+
+		paths = append(paths, SharedPath{
+			Device: name,
+			Source: filepath.Clean(dev["source"]),
+			Path: filepath.Clean(dev["path"]),
+			ReadOnly: shared.IsTrue(dev["readonly"]),
+		})
+	}
+
+	sort.Sort(sharedPathsBySource(paths))
+	return paths
+}
+
+type sharedPathsBySource []SharedPath
+
+func (s sharedPathsBySource) Len() int { return len(s) }
+func (s sharedPathsBySource) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sharedPathsBySource) Less(i, j int) bool { return s[i].Source < s[j].Source }
+
+func isBelow (dir, file string) bool {
+	return file == dir || strings.HasPrefix(file, strings.TrimSuffix(dir, "/")+"/")
+}
+
+//MapHostPath returns the path under which hostPath is visible inside
+//the container, if it is reachable at all
+func MapHostPath (paths []SharedPath, hostPath string) (string, bool) {
+	hostPath = filepath.Clean(hostPath)
+
+	var best *SharedPath = nil
+	for idx := range paths {
+		if !isBelow(paths[idx].Source, hostPath) {
+			continue
+		}
+		if best == nil || len(paths[idx].Source) > len(best.Source) {
+			best = &paths[idx]
+		}
+	}
+
+	if best == nil {
+		return "", false
+	}
+	return filepath.Join(best.Path, strings.TrimPrefix(hostPath, best.Source)), true
+}
+
+//ProjectMountName returns a device name for a project directory, which
+//is stable for the same directory
+func ProjectMountName (hostPath string) string {
+	h := fnv.New32a()
+	h.Write([]byte(filepath.Clean(hostPath)))
+
+	base := unsafeDeviceChars.ReplaceAllString(filepath.Base(hostPath), "_")
+	return fmt.Sprintf("%s%s_%08x", ProjectMountPrefix, base, h.Sum32())
+}
+
+//AddProjectMount shares a host directory with the container
+func AddProjectMount (ctx context.Context, client *lxd.Client, container, hostPath, containerPath string, readOnly bool) (string, error) {
+	name := ProjectMountName(hostPath)
+	props := []string{
+		fmt.Sprintf("source=%s", hostPath),
+		fmt.Sprintf("path=%s", containerPath),
+	}
+	if readOnly {
+		props = append(props, "readonly=true")
+	}
+
+	return name, AddDeviceSync(ctx, client, container, name, "disk", props)
+}
+
+//ContainerCwd translates the host working directory into the container,
+//if it is not shared the user is asked to share it when running in a
+//terminal, otherwise an error listing the shared directories is returned
+func ContainerCwd (ctx context.Context, client *lxd.Client, info *shared.ContainerInfo, cwd string) (string, error) {
+	paths := SharedPaths(info)
+	if containerCwd, ok := MapHostPath(paths, cwd); ok {
+		return containerCwd, nil
+	}
+
+	if IsInteractive() {
+		question := fmt.Sprintf("The directory %s is not shared with the container %s, share it now?", cwd, info.Name)
+		if GetUserConfirmation(question) {
+			_, err := AddProjectMount(ctx, client, info.Name, cwd, cwd, false)
+			if err != nil {
+				return "", err
+			}
+			return cwd, nil
+		}
+	}
+
+	msg := fmt.Sprintf("The working directory %s is not shared with the container %s.\nShared directories:\n", cwd, info.Name)
+	for _, path := range paths {
+		msg += fmt.Sprintf("  %s -> %s\n", path.Source, path.Path)
+	}
+	msg += fmt.Sprintf("Share it with: usdk-target mount add %s %s", info.Name, QuoteString(cwd))
+	return "", fmt.Errorf("%s", msg)
+}
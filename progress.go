@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	ProgressText = "text"
+	ProgressJson = "json"
+)
+
+//ProgressEvent describes the state of a long running operation, Percent
+//is the progress of the current phase or -1 if it is unknown
+type ProgressEvent struct {
+	Phase string `json:"phase"`
+	Percent int `json:"percent"`
+	Message string `json:"message,omitempty"`
+	Operation string `json:"operation,omitempty"`
+}
+
+//InfoOutput receives the informational messages of the helpers and fixables,
+//commands writing machine readable output to stdout point it to stderr
+var InfoOutput io.Writer = os.Stdout
+
+type ProgressReporter interface {
+	Report(event ProgressEvent)
+}
+
+//NewProgressReporter creates a reporter writing the events to out in
+//the given format
+func NewProgressReporter (format string, out io.Writer) (ProgressReporter, error) {
+	switch format {
+	case ProgressText:
+		return &textProgress{out: out}, nil
+	case ProgressJson:
+		return &jsonProgress{out: out}, nil
+	}
+	return nil, fmt.Errorf("Unknown progress format: %s, expected %s or %s", format, ProgressText, ProgressJson)
+}
+
+type textProgress struct {
+	out io.Writer
+}
+
+func (p *textProgress) Report(event ProgressEvent) {
+	if len(event.Message) == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "%s\n", event.Message)
+}
+
+//jsonProgress writes one JSON object per line, events can be reported
+//from multiple goroutines
+type jsonProgress struct {
+	mutex sync.Mutex
+	out io.Writer
+}
+
+func (p *jsonProgress) Report(event ProgressEvent) {
+	js, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fmt.Fprintf(p.out, "%s\n", js)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"sort"
+)
+
+//ShellProgram is a bash program executing a command inside a target,
+//it sources the dotfiles to get a decent shell first
+type ShellProgram struct {
+	Cwd string
+	Env map[string]string
+	PidFile string
+	Args []string
+}
+
+func (p *ShellProgram) String() string {
+	rcFiles := []string{ "/etc/profile", "$HOME/.profile" }
+
+	program := ""
+	for _,rcfile := range rcFiles {
+		program += "test -f "+rcfile+" && . "+rcfile+"; "
+	}
+
+	//the forwarded variables have to win over the ones from the dotfiles
+	keys := make([]string, 0, len(p.Env))
+	for key := range p.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		program += "export "+key+"="+QuoteString(p.Env[key])+"; "
+	}
+
+	//make sure the working directory is the same
+	if len(p.Cwd) > 0 {
+		program += "cd "+QuoteString(p.Cwd)+" && "
+	}
+
+	if len(p.PidFile) > 0 {
+		//write the current shells PID into the pidfile
+		program += fmt.Sprintf("echo $$ > %s; ", p.PidFile)
+	}
+
+	program += "exec"
+	for _,arg := range p.Args {
+		program += " "+QuoteString(arg)
+	}
+	return program
+}
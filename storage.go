@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+//free space that should always be left in the storage, so targets can
+//still be upgraded and builds do not fail
+var MinFreeSpace int64 = 2 * 1024 * 1024 * 1024
+
+//images are compressed, unpacked they need about this many times the space
+const imageUnpackFactor = 3
+
+//Storage describes where LXD keeps the containers
+type Storage struct {
+	//the storage backend: dir, btrfs, zfs or lvm
+	Backend string
+	//the directory, zfs pool or lvm volume group
+	Source string
+	//the free space in bytes
+	Free int64
+}
+
+//freeSpace returns the space available to unprivileged users on the
+//filesystem containing path
+func freeSpace (path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("Could not query the free space of %s. error: %v", path, err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+//toolOutput runs a storage tool and returns its trimmed output
+func toolOutput (name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("Could not run %s. error: %v", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func parseSize (name, out string) (int64, error) {
+	size, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(out), "B"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse the output of %s: %s", name, out)
+	}
+	return int64(size), nil
+}
+
+//LXDStorage returns the storage backing the containers of LXD
+func LXDStorage (client *lxd.Client) (*Storage, error) {
+	status, err := client.ServerStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &Storage{
+		Backend: status.Environment.Storage,
+		Source: shared.VarPath("containers"),
+	}
+
+	switch storage.Backend {
+	case "zfs":
+		storage.Source = fmt.Sprintf("%v", status.Config["storage.zfs_pool_name"])
+		out, err := toolOutput("zfs", "get", "-Hp", "-o", "value", "available", storage.Source)
+		if err != nil {
+			return nil, err
+		}
+		storage.Free, err = parseSize("zfs", out)
+		if err != nil {
+			return nil, err
+		}
+	case "lvm":
+		storage.Source = fmt.Sprintf("%v", status.Config["storage.lvm_vg_name"])
+		out, err := toolOutput("vgs", "--noheadings", "--nosuffix", "--units", "b", "-o", "vg_free", storage.Source)
+		if err != nil {
+			return nil, err
+		}
+		storage.Free, err = parseSize("vgs", out)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		storage.Free, err = freeSpace(storage.Source)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return storage, nil
+}
+
+//lvmUsage returns the space used by the logical volume of a container,
+//thin volumes only use data_percent of their size
+func (s *Storage) lvmUsage (container string) (int64, error) {
+	out, err := toolOutput("lvs", "--noheadings", "--nosuffix", "--units", "b", "--separator", ":",
+		"-o", "lv_size,data_percent", fmt.Sprintf("%s/%s", s.Source, container))
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.SplitN(out, ":", 2)
+	size, err := parseSize("lvs", fields[0])
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) < 2 || len(strings.TrimSpace(fields[1])) == 0 {
+		return size, nil
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse the output of lvs: %s", out)
+	}
+	return int64(float64(size) * percent / 100), nil
+}
+
+//ContainerUsage returns the disk space used by a container. LXD knows it
+//for zfs, the lvm tools need root, otherwise it is measured inside the
+//container, which has to be running for that
+func (s *Storage) ContainerUsage (client *lxd.Client, container string) (int64, error) {
+	state, err := client.ContainerState(container)
+	if err != nil {
+		return 0, err
+	}
+	if disk, ok := state.Disk["root"]; ok && disk.Usage > 0 {
+		return disk.Usage, nil
+	}
+
+	if s.Backend == "lvm" && os.Getuid() == 0 {
+		return s.lvmUsage(container)
+	}
+
+	if state.StatusCode != shared.Running {
+		return 0, fmt.Errorf("The disk usage of %s can only be measured while it is running", container)
+	}
+
+	//-x keeps du out of the shared directories
+	res, err := ExecSync(client, container, []string{"du", "-sxb", "/"})
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(res.Stdout)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Could not measure the disk usage of %s. error: %v", container,
+			&ExecError{Command: []string{"du", "-sxb", "/"}, Result: res})
+	}
+	return parseSize("du", fields[0])
+}
+
+//CheckFreeSpace returns ErrNoSpace if less than required bytes and the
+//minimum free space are left in the storage
+func (s *Storage) CheckFreeSpace (required int64) error {
+	if s.Free < required + MinFreeSpace {
+		return &ErrNoSpace{Storage: s.Source, Free: s.Free, Required: required + MinFreeSpace}
+	}
+	return nil
+}
+
+//CheckImageSpace checks if an image of the given size can be downloaded and
+//unpacked. The download is always stored next to the LXD database, with the
+//dir and btrfs backends the containers are stored on the same filesystem
+func CheckImageSpace (storage *Storage, imageSize int64) error {
+	unpacked := imageSize * imageUnpackFactor
+	if storage.Backend != "zfs" && storage.Backend != "lvm" {
+		return storage.CheckFreeSpace(imageSize + unpacked)
+	}
+
+	imagesDir := shared.VarPath("images")
+	free, err := freeSpace(imagesDir)
+	if err != nil {
+		return err
+	}
+	if free < imageSize {
+		return &ErrNoSpace{Storage: imagesDir, Free: free, Required: imageSize}
+	}
+	return storage.CheckFreeSpace(unpacked)
+}
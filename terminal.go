@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+	"github.com/gorilla/websocket"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+	"github.com/mattn/go-isatty"
+)
+
+type TerminalState struct {
+	termios syscall.Termios
+}
+
+func IsTerminal (fd int) bool {
+	return isatty.IsTerminal(uintptr(fd))
+}
+
+//IsInteractive returns true if both stdin and stdout are connected
+//to a terminal, this is never the case when called from the IDE
+func IsInteractive () bool {
+	return IsTerminal(int(os.Stdin.Fd())) && IsTerminal(int(os.Stdout.Fd()))
+}
+
+func GetTerminalSize (fd int) (width, height int, err error) {
+	var dimensions [4]uint16
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&dimensions)), 0, 0, 0); errno != 0 {
+		return -1, -1, errno
+	}
+	return int(dimensions[1]), int(dimensions[0]), nil
+}
+
+//MakeRawTerminal puts the terminal connected to fd into raw mode and
+//returns the previous state, so it can be restored with RestoreTerminal
+func MakeRawTerminal (fd int) (*TerminalState, error) {
+	var oldState TerminalState
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(&oldState.termios)), 0, 0, 0); errno != 0 {
+		return nil, errno
+	}
+
+	newState := oldState.termios
+	newState.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	newState.Oflag &^= syscall.OPOST
+	newState.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	newState.Cflag &^= syscall.CSIZE | syscall.PARENB
+	newState.Cflag |= syscall.CS8
+	newState.Cc[syscall.VMIN] = 1
+	newState.Cc[syscall.VTIME] = 0
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(&newState)), 0, 0, 0); errno != 0 {
+		return nil, errno
+	}
+
+	return &oldState, nil
+}
+
+func RestoreTerminal (fd int, state *TerminalState) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(&state.termios)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sendTerminalSize (control *websocket.Conn, fd int) error {
+	width, height, err := GetTerminalSize(fd)
+	if err != nil {
+		return err
+	}
+
+	msg := shared.ContainerExecControl{
+		Command: "window-resize",
+		Args: map[string]string{
+			"width": fmt.Sprintf("%d", width),
+			"height": fmt.Sprintf("%d", height),
+		},
+	}
+
+	return control.WriteJSON(msg)
+}
+
+//TerminalControlHandler returns a control handler for lxd.Client.Exec
+//that propagates size changes of the terminal connected to fd into the
+//container, until the control connection is closed
+func TerminalControlHandler (fd int) func(*lxd.Client, *websocket.Conn) {
+	return func (client *lxd.Client, control *websocket.Conn) {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGWINCH)
+		defer signal.Stop(ch)
+
+		//the control connection is closed by Exec when the command exited
+		closed := make(chan bool)
+		go func () {
+			for {
+				if _, _, err := control.NextReader(); err != nil {
+					close(closed)
+					return
+				}
+			}
+		} ()
+
+		for {
+			select {
+			case <-ch:
+				if err := sendTerminalSize(control, fd); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+}
+
+//ExecInteractive runs the command on a pseudo terminal in the container,
+//using the size of the current terminal and forwarding resize events
+func ExecInteractive (client *lxd.Client, container string, command []string, env map[string]string, stdout io.WriteCloser) (int, error) {
+	stdinFd := int(os.Stdin.Fd())
+	width, height, err := GetTerminalSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return -1, err
+	}
+
+	oldState, err := MakeRawTerminal(stdinFd)
+	if err != nil {
+		return -1, err
+	}
+	defer RestoreTerminal(stdinFd, oldState)
+
+	termEnv := map[string]string{}
+	for key, val := range env {
+		termEnv[key] = val
+	}
+	if term := os.Getenv("TERM"); term != "" {
+		termEnv["TERM"] = term
+	}
+
+	return client.Exec(container,
+		command,
+		termEnv,
+		os.Stdin,
+		stdout,
+		os.Stderr,
+		TerminalControlHandler(int(os.Stdout.Fd())),
+		width, height)
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"io/ioutil"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+//usdk-wrapper uses the name of the directory containing the tool link
+//as the container name, so every target gets its own directory
+var ToolFarmDirEnv = "USDK_TOOLS_DIR"
+
+var DefaultTools = []string{
+	"cmake", "ctest", "cpack", "make", "ninja",
+	"qmake", "moc", "rcc", "uic", "lrelease", "lupdate",
+	"gcc", "g++", "cc", "c++", "cpp", "ld", "strip", "objdump",
+	"gdb", "gdbserver", "pkg-config",
+	"click", "qmlscene", "qmltestrunner",
+	"intltool-update", "xgettext", "msgfmt",
+}
+
+//cross compilers and binutils like arm-linux-gnueabihf-g++
+var crossToolPattern = regexp.MustCompile("^[a-z0-9_]+-linux-gnu[a-z]*-(gcc|g\\+\\+|cpp|ld|strip|objcopy|objdump|pkg-config|gdb)(-[0-9.]+)?$")
+
+type ToolLink struct {
+	Name string `json:"name"`
+	Target string `json:"target"`
+	Broken bool `json:"broken"`
+}
+
+//InvokingUser returns the user that called us through sudo or pkexec,
+//or nil if we are not running as root
+func InvokingUser () *user.User {
+	if os.Getuid() != 0 {
+		return nil
+	}
+
+	for _, key := range []string{"SUDO_UID", "PKEXEC_UID"} {
+		uid := os.Getenv(key)
+		if len(uid) == 0 {
+			continue
+		}
+
+		u, err := user.LookupId(uid)
+		if err == nil {
+			return u
+		}
+	}
+	return nil
+}
+
+//ToolFarmBaseDir returns the directory containing the tool directories
+//of all targets, when elevated the one of the invoking user is used
+func ToolFarmBaseDir () string {
+	if dir := os.Getenv(ToolFarmDirEnv); len(dir) > 0 {
+		return dir
+	}
+
+	if u := InvokingUser(); u != nil {
+		return filepath.Join(u.HomeDir, ".local", "share", "ubuntu-sdk-tools", "targets")
+	}
+
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if len(dataDir) == 0 {
+		dataDir = os.ExpandEnv("$HOME/.local/share")
+	}
+	return filepath.Join(dataDir, "ubuntu-sdk-tools", "targets")
+}
+
+func ToolFarmDir (container string) string {
+	return filepath.Join(ToolFarmBaseDir(), container)
+}
+
+func WrapperPath () (string, error) {
+	wrapper, err := exec.LookPath("usdk-wrapper")
+	if err != nil {
+		return "", fmt.Errorf("Could not find usdk-wrapper. error: %v", err)
+	}
+	return filepath.Abs(wrapper)
+}
+
+func isWantedTool (name string) bool {
+	for _, tool := range DefaultTools {
+		if tool == name {
+			return true
+		}
+	}
+	return crossToolPattern.MatchString(name)
+}
+
+//DiscoverTools lists the executables in the PATH of the target that
+//should be made available through usdk-wrapper
+func DiscoverTools (ctx context.Context, client *lxd.Client, container string) ([]string, error) {
+	err := BootContainerSync(ctx, client, container)
+	if err != nil {
+		return nil, err
+	}
+
+	script := "test -f /etc/profile && . /etc/profile; " +
+		"IFS=:; for d in $PATH; do for f in \"$d\"/*; do " +
+		"test -f \"$f\" -a -x \"$f\" && echo \"${f##*/}\"; " +
+		"done; done"
+
+	res, err := ExecSync(client, container, []string{"/bin/bash", "-c", script})
+	if err != nil {
+		return nil, err
+	}
+	if res.Code != 0 {
+		return nil, fmt.Errorf("Listing the tools of %s failed with exit code %d: %s", container, res.Code, res.Stderr)
+	}
+
+	found := map[string]bool{}
+	tools := []string{}
+	for _, name := range strings.Split(res.Stdout, "\n") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 || found[name] || !isWantedTool(name) {
+			continue
+		}
+		found[name] = true
+		tools = append(tools, name)
+	}
+	sort.Strings(tools)
+	return tools, nil
+}
+
+//wrapperLinks returns the names and targets of the links to usdk-wrapper in
+//dir, links the user created to other files are not ours to touch
+func wrapperLinks (dir string) (map[string]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	links := map[string]string{}
+	for _, entry := range entries {
+		if entry.Mode() & os.ModeSymlink != os.ModeSymlink {
+			continue
+		}
+
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if filepath.Base(target) == "usdk-wrapper" {
+			links[entry.Name()] = target
+		}
+	}
+	return links, nil
+}
+
+//ListToolFarm returns the links to usdk-wrapper in the tool directory of
+//the container, links not pointing to the current wrapper are broken
+func ListToolFarm (container string) ([]ToolLink, error) {
+	found, err := wrapperLinks(ToolFarmDir(container))
+	if err != nil {
+		return nil, err
+	}
+
+	//without a wrapper to compare with every link would look broken
+	wrapper, err := WrapperPath()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := []ToolLink{}
+	for _, name := range names {
+		target := found[name]
+
+		broken := target != wrapper
+		if _, err := os.Stat(target); err != nil {
+			broken = true
+		}
+
+		links = append(links, ToolLink{
+			Name: name,
+			Target: target,
+			Broken: broken,
+		})
+	}
+	return links, nil
+}
+
+//InstallToolFarm creates or refreshes the tool directory of the container,
+//links to tools that do not exist anymore in the target are removed
+func InstallToolFarm (ctx context.Context, client *lxd.Client, container string) ([]string, error) {
+	wrapper, err := WrapperPath()
+	if err != nil {
+		return nil, err
+	}
+
+	tools, err := DiscoverTools(ctx, client, container)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if u := InvokingUser(); u != nil {
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+
+	dir := ToolFarmDir(container)
+	err = shared.MkdirAllOwner(dir, 0755, uid, gid)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create the tool directory %s. error: %v", dir, err)
+	}
+
+	existing, err := ListToolFarm(container)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range existing {
+		err = os.Remove(filepath.Join(dir, link.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tool := range tools {
+		linkPath := filepath.Join(dir, tool)
+		if _, err := os.Lstat(linkPath); err == nil {
+			//never replace files we did not create
+			fmt.Fprintf(os.Stderr, "Skipping %s, the file exists already.\n", linkPath)
+			continue
+		}
+
+		err = os.Symlink(wrapper, linkPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the link for %s. error: %v", tool, err)
+		}
+
+		err = os.Lchown(linkPath, uid, gid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
+
+//RepairToolFarm points the broken links of the container back to the
+//current usdk-wrapper, the target is not booted as no new tools are added
+func RepairToolFarm (container string) ([]string, error) {
+	wrapper, err := WrapperPath()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := ToolFarmDir(container)
+	links, err := ListToolFarm(container)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if u := InvokingUser(); u != nil {
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+
+	repaired := []string{}
+	for _, link := range links {
+		if !link.Broken {
+			continue
+		}
+
+		linkPath := filepath.Join(dir, link.Name)
+		err = os.Remove(linkPath)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.Symlink(wrapper, linkPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the link for %s. error: %v", link.Name, err)
+		}
+
+		err = os.Lchown(linkPath, uid, gid)
+		if err != nil {
+			return nil, err
+		}
+		repaired = append(repaired, link.Name)
+	}
+	return repaired, nil
+}
+
+func RemoveToolFarm (container string) error {
+	dir := ToolFarmDir(container)
+	links, err := wrapperLinks(dir)
+	if err != nil {
+		return err
+	}
+
+	for name := range links {
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	//files the user put into the directory are left alone
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil
+	}
+	return os.Remove(dir)
+}
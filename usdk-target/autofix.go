@@ -19,42 +19,165 @@ package main
 
 import (
 	"fmt"
+	"context"
 	"os"
-	"github.com/lxc/lxd"
+	"os/exec"
+	"strings"
+	"github.com/lxc/lxd/shared/gnuflag"
 	"launchpad.net/ubuntu-sdk-tools"
 	"launchpad.net/ubuntu-sdk-tools/fixables"
 )
 
-var fixable_set = []fixables.Fixable{
-	&fixables.ContainerAccess{},
-	&fixables.DevicesFixable{},
-	&fixables.DRIFixable{},
-	&fixables.NvidiaFixable{},
+//applicableFixables resolves the fixables with the given ids, or all of
+//them, and drops the ones that do not apply on this host
+func applicableFixables (ids []string) ([]fixables.Fixable, error) {
+	resolved, err := fixables.Resolve(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []fixables.Fixable{}
+	for _, fixable := range resolved {
+		if fixable.Applies() {
+			result = append(result, fixable)
+		}
+	}
+	return result, nil
+}
+
+//lookupFixables returns exactly the fixables with the given ids, without
+//adding their dependencies
+func lookupFixables (ids []string) ([]fixables.Fixable, error) {
+	result := []fixables.Fixable{}
+	for _, id := range ids {
+		fixable, ok := fixables.Lookup(id)
+		if !ok {
+			return nil, fmt.Errorf("Unknown fixable %s", id)
+		}
+		result = append(result, fixable)
+	}
+	return result, nil
+}
+
+//failedDependency returns the id of a dependency of the fixable that
+//failed or was skipped, or a empty string
+func failedDependency (fixable fixables.Fixable, failed map[string]bool) string {
+	for _, dep := range fixable.DependsOn() {
+		if depFixable, ok := fixables.Lookup(dep); ok && failed[depFixable.ID()] {
+			return depFixable.ID()
+		}
+	}
+	return ""
 }
 
 type autofixCmd struct {
+	progressFormat string
+	noElevate bool
+	fixesOnly bool
 }
 
 func (c *autofixCmd) usage() string {
-	return `Automatically fixes problems in the container backends.`
+	return `Automatically fixes problems in the container backends.
+
+usdk-target autofix [--progress=json] [--no-elevate] [fixable-id]...
+
+Without ids all fixables are run, use "usdk-target fixables" to list them.
+Fixes that need root privileges are run through sudo or pkexec.`
 }
 
 func (c *autofixCmd) flags() {
+	progressFlag(&c.progressFormat)
+	gnuflag.BoolVar(&c.noElevate, "no-elevate", false, "Do not ask for root privileges, only report the fixes that need them")
+	gnuflag.BoolVar(&c.fixesOnly, "fixes-only", false, "Only run the fixables, do not apply the changes to the targets")
 }
 
-func (c *autofixCmd) run(args []string) error {
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+func (c *autofixCmd) run(ctx context.Context, args []string) error {
+	progress, err := newProgress(c.progressFormat)
+	if err != nil {
+		return err
+	}
+
+	//run elevated by another autofix, which reports the end of the job
+	if c.fixesOnly {
+		progress = &nestedProgress{progress}
+	}
+
+	//the parent resolved the dependencies already and passes only the
+	//fixables that have to run as root
+	var fixableSet []fixables.Fixable
+	if c.fixesOnly {
+		fixableSet, err = lookupFixables(args)
+	} else {
+		fixableSet, err = applicableFixables(args)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the container backend.\n")
-		os.Exit(ERR_NO_ACCESS)
+		return err
 	}
 
-	for _, fixable := range fixable_set {
-		err = fixable.Fix(client)
+	client, err := ubuntu_sdk_tools.NewClient("")
+	if err != nil {
+		return err
+	}
+
+	//fixables run in the order of their dependencies, consecutive ones
+	//that need root share one elevated child
+	var fixErr error = nil
+	failed := map[string]bool{}
+	for idx := 0; idx < len(fixableSet); {
+		fixable := fixableSet[idx]
+
+		if dep := failedDependency(fixable, failed); len(dep) > 0 {
+			fmt.Fprintf(os.Stderr, "Skipping %s, it depends on %s which did not succeed.\n", fixable.ID(), dep)
+			failed[fixable.ID()] = true
+			idx++
+			continue
+		}
+
+		if needsElevation(fixable) {
+			rootSet := []fixables.Fixable{}
+			for ; idx < len(fixableSet) && needsElevation(fixableSet[idx]); idx++ {
+				if len(rootSet) > 0 && len(failedDependency(fixableSet[idx], failed)) > 0 {
+					break
+				}
+				rootSet = append(rootSet, fixableSet[idx])
+			}
+
+			progress.Report(ubuntu_sdk_tools.ProgressEvent{
+				Phase: "fix",
+				Percent: (idx - len(rootSet)) * 100 / len(fixableSet),
+				Message: fmt.Sprintf("Running %s as root", strings.Join(fixableIds(rootSet), ", ")),
+			})
+
+			err = c.runElevated(ctx, rootSet)
+			if err != nil {
+				for _, rootFixable := range rootSet {
+					failed[rootFixable.ID()] = true
+				}
+				fixErr = firstError(fixErr, err)
+			}
+			continue
+		}
+
+		progress.Report(ubuntu_sdk_tools.ProgressEvent{
+			Phase: "fix",
+			Percent: idx * 100 / len(fixableSet),
+			Message: fmt.Sprintf("Running %s: %s", fixable.ID(), fixable.Description()),
+		})
+
+		err = fixable.Fix(ctx, client)
 		if err != nil {
-			return err
+			failed[fixable.ID()] = true
+			fixErr = firstError(fixErr, fmt.Errorf("%s failed. error: %v", fixable.ID(), err))
 		}
+		idx++
+	}
+
+	if fixErr != nil {
+		return fixErr
+	}
+
+	if c.fixesOnly {
+		return nil
 	}
 
 	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
@@ -62,11 +185,85 @@ func (c *autofixCmd) run(args []string) error {
 		return err
 	}
 
-	for _, target := range targets {
-		err = ubuntu_sdk_tools.UpdateConfigSync(client, target.Name)
+	for idx, target := range targets {
+		progress.Report(ubuntu_sdk_tools.ProgressEvent{
+			Phase: "update-config",
+			Percent: idx * 100 / len(targets),
+			Message: fmt.Sprintf("Updating target %d of %d", idx+1, len(targets)),
+		})
+
+		err = ubuntu_sdk_tools.UpdateConfigSync(ctx, client, target.Name)
 		if err != nil {
 			return err
 		}
 	}
+
+	progress.Report(ubuntu_sdk_tools.ProgressEvent{Phase: "done", Percent: 100})
 	return nil
-}
\ No newline at end of file
+}
+
+//runElevated runs the fixables in a copy of ourselves as root, if that
+//is not possible a error naming the fixes that need root is returned
+func (c *autofixCmd) runElevated(ctx context.Context, rootSet []fixables.Fixable) error {
+	ids := fixableIds(rootSet)
+
+	elevator := elevationCommand()
+	if !c.noElevate && elevator != nil {
+		exe, err := os.Readlink("/proc/self/exe")
+		if err != nil {
+			return fmt.Errorf("Could not determine the path of usdk-target. error: %v", err)
+		}
+
+		args := append(elevator, exe, "autofix", "--fixes-only", "--progress="+c.progressFormat)
+		args = append(args, ids...)
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err = cmd.Run()
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Running the fixes as root failed. error: %v\n", err)
+	}
+
+	msg := "The following fixes need root privileges:\n"
+	for _, fixable := range rootSet {
+		msg += fmt.Sprintf("  %s: %s\n", fixable.ID(), fixable.Description())
+	}
+	msg += fmt.Sprintf("Run them with: sudo usdk-target autofix %s", strings.Join(ids, " "))
+	return &ubuntu_sdk_tools.ErrNeedsFixing{Err: fmt.Errorf("%s", msg)}
+}
+
+//firstError keeps the first error to return it, the later ones are only
+//printed
+func firstError (first error, err error) error {
+	if first == nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return first
+}
+
+func fixableIds (fixableSet []fixables.Fixable) []string {
+	ids := []string{}
+	for _, fixable := range fixableSet {
+		ids = append(ids, fixable.ID())
+	}
+	return ids
+}
+
+//nestedProgress passes the events of a child process into the stream of
+//its parent, without ending the job of the parent
+type nestedProgress struct {
+	ubuntu_sdk_tools.ProgressReporter
+}
+
+func (p *nestedProgress) Report(event ubuntu_sdk_tools.ProgressEvent) {
+	if event.Phase == "done" {
+		return
+	}
+	p.ProgressReporter.Report(event)
+}
@@ -21,10 +21,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"launchpad.net/ubuntu-sdk-tools"
-	"github.com/lxc/lxd"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/gnuflag"
 )
@@ -43,7 +43,7 @@ func (c *autosetupCmd) flags() {
 	gnuflag.BoolVar(&c.yes, "y", false, "Assume yes to all questions.")
 }
 
-func (c *autosetupCmd) run(args []string) error {
+func (c *autosetupCmd) run(ctx context.Context, args []string) error {
 	if os.Getuid() != 0 {
 		return fmt.Errorf("This command needs to run as root")
 	}
@@ -53,10 +53,9 @@ func (c *autosetupCmd) run(args []string) error {
 		}
 	}
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		return fmt.Errorf("Could not connect to the LXD server.\n")
+		return err
 	}
 
 	containers, err := client.ListContainers()
@@ -70,7 +69,7 @@ func (c *autosetupCmd) run(args []string) error {
 	for _, container := range containers {
 		if container.StatusCode != 0 && container.StatusCode != shared.Stopped {
 			fmt.Printf("Stopping %s .....", container.Name)
-			err = ubuntu_sdk_tools.StopContainerSync(client, container.Name)
+			err = ubuntu_sdk_tools.StopContainerSync(ctx, client, container.Name)
 			if (err != nil) {
 				return fmt.Errorf("Could not stop container %s. error: %v.",container.Name, err)
 			}
@@ -81,14 +80,12 @@ func (c *autosetupCmd) run(args []string) error {
 	fmt.Println("All containers stopped.")
 
 	fmt.Printf("\nCreating default network bridge .....")
-	initCmd := &initializedCmd{}
-
-	err = initCmd.lxdBridgeConfigured(client)
+	err = ubuntu_sdk_tools.CheckLXDBridge(client)
 	if err != nil {
 		//empty config
 		config := map[string]string{}
 
-		bridgeName := "sdkbr0"
+		bridgeName := ubuntu_sdk_tools.SdkBridgeName
 		err := client.NetworkCreate(bridgeName, config)
 		if err != nil {
 			fmt.Print(" FAILED\n")
@@ -128,7 +125,7 @@ func (c *autosetupCmd) run(args []string) error {
 		fmt.Println("\nStarting previously stopped containers:")
 		for _, container := range stoppedContainers {
 			fmt.Printf("Starting %s .....", container)
-			err = ubuntu_sdk_tools.BootContainerSync(client, container)
+			err = ubuntu_sdk_tools.BootContainerSync(ctx, client, container)
 			if (err != nil) {
 				fmt.Print(" FAILED\n")
 			} else {
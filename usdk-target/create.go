@@ -27,6 +27,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/lxc/lxd"
 	"github.com/lxc/lxd/shared"
@@ -35,6 +36,7 @@ import (
 	"os"
 	"strings"
 	"regexp"
+	"strconv"
 )
 
 type createCmd struct {
@@ -44,13 +46,16 @@ type createCmd struct {
 	name            string
 	createSupGroups bool
 	enableUpdates   bool
+	useCCache       bool
+	progressFormat  string
+	progress        ubuntu_sdk_tools.ProgressReporter
 }
 
 func (c *createCmd) usage() string {
 	return `\
 Creates a new Ubuntu SDK build target.
 
-usdk-target create -n NAME -p FINGERPRINT
+usdk-target create [-g] [-c] [--progress=json] -n NAME -p FINGERPRINT
 `
 }
 
@@ -62,11 +67,13 @@ func (c *createCmd) flags() {
 	gnuflag.StringVar(&c.fingerprint, "p", requiredString, "sha256 fingerprint of the base image")
 	gnuflag.StringVar(&c.name, "n", requiredString, "name of the container")
 	gnuflag.BoolVar(&c.createSupGroups, "g", false, "Also try to create the users supplementary groups")
+	gnuflag.BoolVar(&c.useCCache, "c", false, "Use a ccache directory shared with all targets of the same framework and architecture")
+	progressFlag(&c.progressFormat)
 }
 
 
 
-func (c *createCmd) run(args []string) error {
+func (c *createCmd) run(ctx context.Context, args []string) error {
 	if c.fingerprint == requiredString || c.name == requiredString {
 		gnuflag.PrintDefaults()
 		return fmt.Errorf("Missing arguments")
@@ -76,11 +83,15 @@ func (c *createCmd) run(args []string) error {
 		return fmt.Errorf("This command needs to run as root")
 	}
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, "ubuntu-sdk-images")
+	progress, err := newProgress(c.progressFormat)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the remote LXD server.\n")
-		os.Exit(1)
+		return err
+	}
+	c.progress = progress
+
+	client, err := ubuntu_sdk_tools.NewClient(ubuntu_sdk_tools.ImageRemoteName)
+	if err != nil {
+		return err
 	}
 
 	//get image informations
@@ -121,14 +132,23 @@ func (c *createCmd) run(args []string) error {
 	}
 
 
-	fmt.Printf("Creating image with:\nframework: %s\narch: %s\n", c.framework, c.architecture)
-	client, err = lxd.NewClient(config, config.DefaultRemote)
+	fmt.Fprintf(ubuntu_sdk_tools.InfoOutput, "Creating image with:\nframework: %s\narch: %s\n", c.framework, c.architecture)
+	client, err = ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the LXD server.\n")
-		os.Exit(1)
+		return err
 	}
 
 
+	//fail early instead of after downloading a multi-GB image
+	storage, err := ubuntu_sdk_tools.LXDStorage(client)
+	if err != nil {
+		return err
+	}
+	err = ubuntu_sdk_tools.CheckImageSpace(storage, requestedImage.Size)
+	if err != nil {
+		return err
+	}
+
 	//name string, imgremote string, image string, profiles *[]string, config map[string]string, ephem bool
 	var prof *[]string
 	conf := make(map[string]string)
@@ -143,13 +163,20 @@ func (c *createCmd) run(args []string) error {
 
 	devicesMap := map[string]shared.Device{}
 
-	resp, err := client.Init(c.name, "ubuntu-sdk-images", c.fingerprint, prof, conf, devicesMap, false)
+	operation := fmt.Sprintf("creating the container %s", c.name)
+	c.report("create", 0, fmt.Sprintf("Creating container %s", c.name))
+
+	var resp *lxd.Response
+	err = ubuntu_sdk_tools.RunWithContext(ctx, operation, func () (err error) {
+		resp, err = client.Init(c.name, ubuntu_sdk_tools.ImageRemoteName, c.fingerprint, prof, conf, devicesMap, false)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
 	c.initProgressTracker(client, resp.Operation)
-	err = client.WaitForSuccess(resp.Operation)
+	err = ubuntu_sdk_tools.WaitForOperation(ctx, client, resp.Operation, operation)
 
 	if err != nil {
 		return err
@@ -166,40 +193,91 @@ func (c *createCmd) run(args []string) error {
 
 		if len(containers) == 1 && c.name == "" {
 			fields := strings.Split(containers[0], "/")
-			fmt.Printf("Container name is: %s\n", fields[len(fields)-1])
+			fmt.Fprintf(ubuntu_sdk_tools.InfoOutput, "Container name is: %s\n", fields[len(fields)-1])
 		}
 	}
 
-	for _, fixable := range fixable_set {
-		err = fixable.Fix(client)
+	c.report("fix", -1, "Fixing the container configuration")
+	fixableSet, err := applicableFixables(nil)
+	if err != nil {
+		c.removeContainer(client)
+		return err
+	}
+	for _, fixable := range fixableSet {
+		err = fixable.Fix(ctx, client)
 		if err != nil {
-			ubuntu_sdk_tools.RemoveContainerSync(client, c.name)
+			c.removeContainer(client)
 			return err
 		}
 	}
 
-	//add the required devices
-	err = ubuntu_sdk_tools.AddDeviceSync(client, c.name, "tmp", "disk", []string{"source=/tmp", "path=/tmp", "recursive=true"})
+	//the shared /tmp was added by the mounts fixable
+	c.report("register", -1, "Registering the user")
+	err = RegisterUserInContainer(ctx, client, c.name, nil, c.createSupGroups)
 	if err != nil {
-		ubuntu_sdk_tools.RemoveContainerSync(client, c.name)
+		c.removeContainer(client)
 		return err
 	}
 
-	err = RegisterUserInContainer(client, c.name, nil, c.createSupGroups)
+	if c.useCCache {
+		c.report("ccache", -1, "Enabling ccache")
+		err = c.enableCCache(ctx, client)
+		if err != nil {
+			c.removeContainer(client)
+			return err
+		}
+	}
+
+	c.report("update-config", -1, "Applying the configuration")
+	err = ubuntu_sdk_tools.UpdateConfigSync(ctx, client, c.name)
 	if err != nil {
-		ubuntu_sdk_tools.RemoveContainerSync(client, c.name)
+		c.removeContainer(client)
 		return err
 	}
 
-	ubuntu_sdk_tools.UpdateConfigSync(client, c.name)
+	c.report("done", 100, fmt.Sprintf("Container %s created", c.name))
+	return nil
+}
+
+//removeContainer cleans up a partially created container, this has to
+//work even if the command was canceled
+func (c *createCmd) removeContainer(client *lxd.Client) {
+	ctx, cancel := cleanupContext()
+	defer cancel()
+
+	err := ubuntu_sdk_tools.RemoveContainerSync(ctx, client, c.name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not remove the container %s. error: %v\n", c.name, err)
+	}
+}
+
+func (c *createCmd) enableCCache(ctx context.Context, client *lxd.Client) error {
+	userName, err := userFromEnv()
 	if err != nil {
-		ubuntu_sdk_tools.RemoveContainerSync(client, c.name)
 		return err
 	}
+	if userName == nil {
+		return fmt.Errorf("Could not determine the user owning the ccache directory.")
+	}
 
-	return nil
+	pw, err := ubuntu_sdk_tools.Getpwnam(*userName)
+	if err != nil {
+		return fmt.Errorf("Querying the user entry failed. error: %v", err)
+	}
+
+	return ubuntu_sdk_tools.EnableCCache(ctx, client, c.name, c.framework, c.architecture, pw)
 }
 
+func (c *createCmd) report(phase string, percent int, message string) {
+	c.progress.Report(ubuntu_sdk_tools.ProgressEvent{
+		Phase: phase,
+		Percent: percent,
+		Message: message,
+	})
+}
+
+var percentRegex = regexp.MustCompile("(\\d+)%")
+
 func (c *createCmd) initProgressTracker(d *lxd.Client, operation string) {
 	handler := func(msg interface{}) {
 		if msg == nil {
@@ -216,7 +294,8 @@ func (c *createCmd) initProgressTracker(d *lxd.Client, operation string) {
 		}
 
 		md := event["metadata"].(map[string]interface{})
-		if !strings.HasSuffix(operation, md["id"].(string)) {
+		opId := md["id"].(string)
+		if !strings.HasSuffix(operation, opId) {
 			return
 		}
 
@@ -229,14 +308,22 @@ func (c *createCmd) initProgressTracker(d *lxd.Client, operation string) {
 		}
 
 		opMd := md["metadata"].(map[string]interface{})
-		_, ok := opMd["download_progress"]
-		if ok {
-			fmt.Printf("Retrieving image: %s\n", opMd["download_progress"].(string))
+		download, ok := opMd["download_progress"].(string)
+		if !ok {
+			return
 		}
 
-		if opMd["download_progress"].(string) == "100%" {
-			fmt.Printf("\n")
+		percent := -1
+		if match := percentRegex.FindStringSubmatch(download); match != nil {
+			percent, _ = strconv.Atoi(match[1])
 		}
+
+		c.progress.Report(ubuntu_sdk_tools.ProgressEvent{
+			Phase: "download",
+			Percent: percent,
+			Message: fmt.Sprintf("Retrieving image: %s", download),
+			Operation: opId,
+		})
 	}
 	go d.Monitor([]string{"operation"}, handler)
 }
@@ -20,9 +20,9 @@ package main
 import (
 )
 import (
+	"context"
 	"fmt"
 	"os"
-	"github.com/lxc/lxd"
 	"launchpad.net/ubuntu-sdk-tools"
 )
 
@@ -39,19 +39,24 @@ usdk-target destroy container`
 func (c *destroyCmd) flags() {
 }
 
-func (c *destroyCmd) run(args []string) error {
+func (c *destroyCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
 		fmt.Fprint(os.Stderr, c.usage())
 		os.Exit(1)
 	}
 	c.container = args[0]
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		return fmt.Errorf("Could not connect to the LXD server.")
-		os.Exit(1)
+		return err
+	}
+
+	err = ubuntu_sdk_tools.RemoveContainerSync(ctx, client, c.container)
+	if err != nil {
+		return err
 	}
 
-	return ubuntu_sdk_tools.RemoveContainerSync(client, c.container)
+	//the tool links are useless without the container
+	_ = ubuntu_sdk_tools.RemoveToolFarm(c.container)
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"os"
+	"os/exec"
+	"launchpad.net/ubuntu-sdk-tools"
+	"launchpad.net/ubuntu-sdk-tools/fixables"
+)
+
+//needsElevation returns true if the fixable has to run in a copy of
+//ourselves as root, when running as root nothing needs to be elevated
+func needsElevation (fixable fixables.Fixable) bool {
+	return fixable.NeedsRoot() && os.Getuid() != 0
+}
+
+//elevationCommand returns the command to run a program as root, in a
+//terminal sudo can ask for the password, otherwise e.g. when started by
+//the IDE pkexec asks through the graphical polkit agent
+func elevationCommand () []string {
+	if ubuntu_sdk_tools.IsInteractive() {
+		if path, err := exec.LookPath("sudo"); err == nil {
+			return []string{path}
+		}
+	}
+	if path, err := exec.LookPath("pkexec"); err == nil {
+		return []string{path}
+	}
+	return nil
+}
@@ -18,21 +18,41 @@
 package main
 
 import (
-)
-import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
 	"github.com/lxc/lxd/shared/gnuflag"
 	"launchpad.net/ubuntu-sdk-tools"
-	"syscall"
-	"os/exec"
+	"strings"
+	"github.com/pborman/uuid"
 )
 
+//envFlag collects the KEY=VAL pairs passed with -e
+type envFlag map[string]string
+
+func (f envFlag) String() string {
+	pairs := []string{}
+	for key, val := range f {
+		pairs = append(pairs, key+"="+val)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f envFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || !ubuntu_sdk_tools.IsValidEnvName(parts[0]) {
+		return fmt.Errorf("Invalid environment variable: %s, expected KEY=VAL", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
 type execCmd struct {
 	maintMode bool
 	container string
 	user string
+	env envFlag
 }
 
 func (c *execCmd) usage() string {
@@ -43,7 +63,8 @@ func (c *execCmd) usage() string {
 
 	return fmt.Sprintf(`Executes a command in the container.
 
-usdk-target %s container [command]`, myMode)
+usdk-target %s container	Opens a login shell
+usdk-target %s [-e KEY=VAL]... container command	Executes the command, -e sets additional environment variables`, myMode, myMode)
 }
 
 func (c *execCmd) flags() {
@@ -53,9 +74,18 @@ func (c *execCmd) flags() {
 	}
 
 	gnuflag.StringVar(&c.user, "u", c.user, "Username to login before executing the command.")
+
+	c.env = envFlag{}
+	gnuflag.Var(c.env, "e", "Set an environment variable (KEY=VAL) for the command, can be used multiple times.")
+}
+
+//the signals are forwarded into the container by ForwardSignals or, on
+//a terminal, sent as control characters
+func (c *execCmd) forwardsSignals() bool {
+	return true
 }
 
-func (c *execCmd) run(args []string) error {
+func (c *execCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
 		fmt.Fprint(os.Stderr, c.usage())
 		os.Exit(1)
@@ -64,54 +94,109 @@ func (c *execCmd) run(args []string) error {
 	c.container = args[0]
 	args = args[1:]
 
-	lxc_command, err := exec.LookPath("lxc")
+	//su -l resets the environment of the login shell
+	if len(args) == 0 && len(c.env) > 0 {
+		return fmt.Errorf("Environment variables (-e) can only be set when executing a command.")
+	}
+
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
 		return err
 	}
 
-	lxc_args := []string {
-		lxc_command, "exec",
-		c.container, "--",
-		"su",
+	err = ubuntu_sdk_tools.BootContainerSync(ctx, client, c.container)
+	if err != nil {
+		return err
 	}
 
+	command := []string{"su"}
 	if len(args) == 0 {
-		lxc_args = append(lxc_args,"-l")
+		command = append(command, "-l")
 	}
-
-	lxc_args = append(lxc_args, []string {
-		"-s", "/bin/bash"}...)
+	command = append(command, "-s", "/bin/bash")
 
 	if (!c.maintMode) {
-		lxc_args = append(lxc_args, c.user)
+		command = append(command, c.user)
 	}
 
+	pidfile := ""
 	if len(args) > 0 {
-		rcFiles := []string{ "/etc/profile", "$HOME/.profile" }
-		cwd, _ := os.Getwd()
+		info, err := ubuntu_sdk_tools.GetContainerInfo(client, c.container)
+		if err != nil {
+			return err
+		}
+
+		env := ubuntu_sdk_tools.NewEnvPolicy(info.ExpandedConfig).Environment(os.Environ())
 
-		program := ""
-		for _,rcfile := range rcFiles {
-			program += "test -f "+rcfile+" && . "+rcfile+"; "
+		//apps started from the target should show up on the display of the caller
+		displayEnv, err := ubuntu_sdk_tools.NewDisplaySession(os.Environ()).Environment(info)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		for key, val := range displayEnv {
+			env[key] = val
 		}
 
-		//make sure the working directory is the same
-		program += "cd \""+cwd+"\" && "
+		audioEnv, err := ubuntu_sdk_tools.AudioEnvironment(info, os.Environ())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		for key, val := range audioEnv {
+			env[key] = val
+		}
+
+		for key, val := range c.env {
+			env[key] = val
+		}
+
+		cwd, _ := os.Getwd()
+		containerCwd, err := ubuntu_sdk_tools.ContainerCwd(ctx, client, info, cwd)
+		if err != nil {
+			return err
+		}
 
-		//force C locale as QtCreator needs it
-		program +=" LC_ALL=C "
+		program := ubuntu_sdk_tools.ShellProgram{
+			Cwd: containerCwd,
+			Env: env,
+			Args: args,
+		}
 
-		for _,arg := range args {
-			program += " "+ubuntu_sdk_tools.QuoteString(arg)
+		//without a terminal signals have to be forwarded by hand
+		if !ubuntu_sdk_tools.IsInteractive() {
+			pidfile = fmt.Sprintf("/tmp/%x.pid", uuid.NewUUID())
+			program.PidFile = pidfile
+			ubuntu_sdk_tools.ForwardSignals(client, c.container, pidfile)
 		}
 
-		lxc_args = append(lxc_args, []string {
-			"-c", program}...)
+		command = append(command, "-c", program.String())
 	}
 
-	os.Stdout.Sync()
-	os.Stderr.Sync()
-	err = syscall.Exec(lxc_command, lxc_args, os.Environ())
-	fmt.Printf("Error: %v\n", err)
+	stopKeepAlive := ubuntu_sdk_tools.KeepAlive(c.container)
+
+	var code int
+	if ubuntu_sdk_tools.IsInteractive() {
+		code, err = ubuntu_sdk_tools.ExecInteractive(client, c.container, command, map[string]string{}, os.Stdout)
+	} else {
+		code, err = client.Exec(c.container,
+			command,
+			map[string]string{},
+			os.Stdin,
+			os.Stdout,
+			os.Stderr,
+			nil, 0, 0)
+	}
+	stopKeepAlive()
+
+	if len(pidfile) > 0 {
+		//the pidfile is created in /tmp, which is shared with the host
+		_ = os.Remove(pidfile)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Could not execute the command. error: %v", err)
+	}
+	if code != 0 {
+		return exitCode(code)
+	}
 	return nil
 }
@@ -20,9 +20,9 @@ package main
 import (
 )
 import (
+	"context"
 	"fmt"
 	"os"
-	"github.com/lxc/lxd"
 	"launchpad.net/ubuntu-sdk-tools"
 )
 
@@ -38,14 +38,13 @@ usdk-target exists container`
 func (c *existsCmd) flags() {
 }
 
-func (c *existsCmd) run(args []string) error {
+func (c *existsCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
 		fmt.Fprint(os.Stderr, c.usage())
 		os.Exit(1)
 	}
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	d, err := lxd.NewClient(config, config.DefaultRemote)
+	d, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
 		return err
 	}
@@ -62,5 +61,5 @@ func (c *existsCmd) run(args []string) error {
 		}
 	}
 
-	return fmt.Errorf("Container not found")
+	return &ubuntu_sdk_tools.ErrNotFound{Container: args[0]}
 }
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"launchpad.net/ubuntu-sdk-tools/fixables"
+)
+
+type fixablesCmd struct {
+}
+
+type fixableDesc struct {
+	Id string `json:"id"`
+	Description string `json:"description"`
+	DependsOn []string `json:"depends_on"`
+	NeedsRoot bool `json:"needs_root"`
+	Applies bool `json:"applies"`
+}
+
+func (c *fixablesCmd) usage() string {
+	return `Lists the fixables used by autofix, in the order they are run.
+
+usdk-target fixables`
+}
+
+func (c *fixablesCmd) flags() {
+}
+
+func (c *fixablesCmd) run(ctx context.Context, args []string) error {
+	all, err := fixables.All()
+	if err != nil {
+		return err
+	}
+
+	result := []fixableDesc{}
+	for _, fixable := range all {
+		deps := fixable.DependsOn()
+		if deps == nil {
+			deps = []string{}
+		}
+
+		result = append(result, fixableDesc{
+			Id: fixable.ID(),
+			Description: fixable.Description(),
+			DependsOn: deps,
+			NeedsRoot: fixable.NeedsRoot(),
+			Applies: fixable.Applies(),
+		})
+	}
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("Could not marshal the result into a valid json string. error: %v.", err)
+	}
+	fmt.Printf("%s\n", js)
+	return nil
+}
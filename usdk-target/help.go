@@ -24,6 +24,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
@@ -42,14 +43,14 @@ func (c *helpCmd) usage() string {
 func (c *helpCmd) flags() {
 }
 
-func (c *helpCmd) run(args []string) error {
+func (c *helpCmd) run(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		for _, name := range args {
 			cmd, ok := commands[name]
 			if !ok {
 				fmt.Fprintf(os.Stderr, "error: unknown command: %s\n", name)
 			} else {
-				fmt.Fprintf(os.Stderr, cmd.usage()+"\n")
+				fmt.Fprintln(os.Stderr, cmd.usage())
 			}
 		}
 		return nil
@@ -67,6 +68,8 @@ func (c *helpCmd) run(args []string) error {
 		fmt.Printf("\t%-10s - %s\n", name, c.summaryLine(cmd.usage()))
 	}
 
+	fmt.Println("Options:")
+	fmt.Println("  --timeout DURATION " + "Cancel the command if it takes longer, e.g. 5m.")
 	fmt.Println("Environment:")
 	fmt.Println("  LXD_CONF           " + "Path to an alternate client configuration directory.")
 	fmt.Println("  LXD_DIR            " + "Path to an alternate server directory.")
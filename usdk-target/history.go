@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"io"
+	"syscall"
+	"encoding/json"
+	"github.com/lxc/lxd/shared/gnuflag"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type historyCmd struct {
+	showOutput string
+	replay string
+}
+
+func (c *historyCmd) usage() string {
+	return `Lists the usdk-wrapper invocations recorded in the build journal.
+
+The journal is enabled with "usdk-target set <container> journal-enabled"
+or by setting USDK_JOURNAL=1 in the environment of usdk-wrapper.
+
+usdk-target history [container]
+usdk-target history -o ID
+usdk-target history -r ID`
+}
+
+func (c *historyCmd) flags() {
+	gnuflag.StringVar(&c.showOutput, "o", "", "Print the recorded output of the invocation.")
+	gnuflag.StringVar(&c.replay, "r", "", "Run the invocation again, in the same working directory.")
+}
+
+func (c *historyCmd) run(ctx context.Context, args []string) error {
+	if len(c.showOutput) > 0 {
+		entry, err := ubuntu_sdk_tools.FindJournalEntry(c.showOutput)
+		if err != nil {
+			return err
+		}
+
+		output, err := ubuntu_sdk_tools.OpenJournalOutput(entry)
+		if err != nil {
+			return fmt.Errorf("Could not open the recorded output. error: %v", err)
+		}
+		defer output.Close()
+
+		_, err = io.Copy(os.Stdout, output)
+		return err
+	}
+
+	if len(c.replay) > 0 {
+		entry, err := ubuntu_sdk_tools.FindJournalEntry(c.replay)
+		if err != nil {
+			return err
+		}
+
+		err = os.Chdir(entry.Cwd)
+		if err != nil {
+			return fmt.Errorf("Could not change into %s. error: %v", entry.Cwd, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Running %s in %s\n", entry.CommandLine(), entry.Cwd)
+		os.Stdout.Sync()
+		os.Stderr.Sync()
+		err = syscall.Exec(entry.Tool, append([]string{entry.Tool}, entry.Args...), os.Environ())
+		return fmt.Errorf("Could not run %s. error: %v", entry.Tool, err)
+	}
+
+	container := ""
+	if len(args) > 0 {
+		container = args[0]
+	}
+
+	entries, err := ubuntu_sdk_tools.ListJournal(container)
+	if err != nil {
+		return err
+	}
+
+	js, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("Could not marshal the result into a valid json string. error: %v.", err)
+	}
+	fmt.Printf("%s\n", js)
+	return nil
+}
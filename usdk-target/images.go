@@ -20,6 +20,7 @@ package main
 import (
 )
 import (
+	"context"
 	"github.com/lxc/lxd"
 	"launchpad.net/ubuntu-sdk-tools"
 	"fmt"
@@ -90,10 +91,9 @@ func findRelevantImages(client *lxd.Client) ([]imageDesc, error) {
 	return imageDescs, nil
 }
 
-func (c *imagesCmd) run(args []string) error {
+func (c *imagesCmd) run(ctx context.Context, args []string) error {
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	d, err := lxd.NewClient(config, "ubuntu-sdk-images")
+	d, err := ubuntu_sdk_tools.NewClient(ubuntu_sdk_tools.ImageRemoteName)
 	if err != nil {
 		return err
 	}
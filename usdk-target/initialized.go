@@ -18,12 +18,13 @@
 package main
 
 import (
-)
-import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"launchpad.net/ubuntu-sdk-tools"
 	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/gnuflag"
 )
 
@@ -31,6 +32,7 @@ const (
 	ERR_NO_ACCESS    = 255
 	ERR_NEEDS_FIXING = 254
 	ERR_NO_BRIDGE    = 253
+	ERR_NO_SPACE     = 252
 	//ERR_UNKNOWN      = 200
 )
 
@@ -48,61 +50,102 @@ func (c *initializedCmd) flags() {
 	gnuflag.BoolVar(&c.ignoreBridgeCheck, "b", false, "Do not check for lxd bridge")
 }
 
-func (c *initializedCmd) run(args []string) error {
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+func (c *initializedCmd) run(ctx context.Context, args []string) error {
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the container backend.\n")
-		os.Exit(ERR_NO_ACCESS)
+		return err
 	}
 
-	_, err = client.ServerStatus()
+	err = ubuntu_sdk_tools.CheckBackend(client)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not talk to the container backend.\n")
-		os.Exit(ERR_NO_ACCESS)
+		return err
 	}
 
 	if !c.ignoreBridgeCheck {
-		err := c.lxdBridgeConfigured(client)
+		err := ubuntu_sdk_tools.CheckLXDBridge(client)
 		if (err != nil) {
-			os.Exit(ERR_NO_BRIDGE)
+			return err
 		}
 		fmt.Println("LXD bridge is configured with a subnet.")
 	} else {
 		fmt.Println("Skipping bridge check.")
 	}
 
-	for _,fixable := range fixable_set {
-		fixableErr := fixable.Check(client)
-		if fixableErr != nil {
-			fmt.Printf("Error: %v\n", fixableErr)
-			os.Exit(ERR_NEEDS_FIXING)
-		}
+	err = c.checkStorage(client)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Container backend is ready.")
-	return nil
-}
-
-func (c *initializedCmd) lxdBridgeConfigured (client *lxd.Client) (error) {
-	netConfList, err := client.ListNetworks()
+	fixableSet, err := applicableFixables(nil)
 	if err != nil {
 		return err
 	}
 
-	for _,netConf := range netConfList {
-		if !netConf.Managed || netConf.Type != "bridge" {
+	//report all problems, so it is clear if fixing them needs root
+	needsRoot := []string{}
+	needsFixing := []string{}
+	for _,fixable := range fixableSet {
+		//the network fixable checks the bridges of the targets
+		if c.ignoreBridgeCheck && fixable.ID() == "network" {
 			continue
 		}
 
-		if addr, ok := netConf.Config["ipv4.address"]; !ok || addr == "" {
+		fixableErr := fixable.Check(ctx, client)
+		if fixableErr == nil {
 			continue
 		}
 
-		//compatible bridge found
-		return nil
+		if fixable.NeedsRoot() && os.Getuid() != 0 {
+			fmt.Printf("Needs fixing as root: %s: %v\n", fixable.ID(), fixableErr)
+			needsRoot = append(needsRoot, fixable.ID())
+		} else {
+			fmt.Printf("Needs fixing: %s: %v\n", fixable.ID(), fixableErr)
+			needsFixing = append(needsFixing, fixable.ID())
+		}
+	}
+
+	if len(needsRoot) > 0 || len(needsFixing) > 0 {
+		msg := "Run usdk-target autofix to fix the problems."
+		if len(needsRoot) > 0 {
+			msg += fmt.Sprintf(" Fixing %s requires root privileges.", strings.Join(needsRoot, ", "))
+		}
+		return &ubuntu_sdk_tools.ErrNeedsFixing{Err: fmt.Errorf("%s", msg)}
 	}
 
-	// we found nothing
-	return fmt.Errorf("lxd-bridge not configured")
+	fmt.Println("Container backend is ready.")
+	return nil
+}
+
+//checkStorage reports the free space of the storage backing LXD and the
+//disk usage of the targets, the zfs and lvm tools need root, so for other
+//users a failed query is only reported. Running low on space is a warning,
+//creating a target fails with ERR_NO_SPACE instead
+func (c *initializedCmd) checkStorage(client *lxd.Client) error {
+	storage, err := ubuntu_sdk_tools.LXDStorage(client)
+	if err != nil {
+		fmt.Printf("Could not check the free space of the LXD storage: %v\n", err)
+
+		//the usage of the targets is still known to LXD or the targets
+		storage = &ubuntu_sdk_tools.Storage{}
+	} else {
+		fmt.Printf("Storage %s (%s) has %s free.\n", storage.Source, storage.Backend, shared.GetByteSizeString(storage.Free))
+		if err = storage.CheckFreeSpace(0); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		used, err := storage.ContainerUsage(client, target.Name)
+		if err != nil {
+			fmt.Printf("Could not determine the disk usage of %s: %v\n", target.Name, err)
+			continue
+		}
+		fmt.Printf("Target %s uses %s.\n", target.Name, shared.GetByteSizeString(used))
+	}
+	return nil
 }
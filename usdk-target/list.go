@@ -18,7 +18,7 @@
 package main
 
 import (
-	"github.com/lxc/lxd"
+	"context"
 	"encoding/json"
 	"launchpad.net/ubuntu-sdk-tools"
 	"fmt"
@@ -37,10 +37,9 @@ usdk-wrapper list`)
 func (c *listCmd) flags() {
 }
 
-func (c *listCmd) run(args []string) error {
+func (c *listCmd) run(ctx context.Context, args []string) error {
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	d, err := lxd.NewClient(config, config.DefaultRemote)
+	d, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
 		return err
 	}
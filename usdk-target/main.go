@@ -28,11 +28,14 @@
 package main
 
 import (
+	"context"
 	"github.com/lxc/lxd/shared/gnuflag"
 	"os"
 	"strings"
 	"fmt"
 	"syscall"
+	"os/signal"
+	"time"
 	"net"
 	"net/url"
 	"launchpad.net/ubuntu-sdk-tools"
@@ -43,7 +46,7 @@ var errArgs = fmt.Errorf("wrong number of subcommand arguments")
 type command interface {
 	usage() string
 	flags()
-	run(args []string) error
+	run(ctx context.Context, args []string) error
 }
 
 var commands = map[string]command{
@@ -63,46 +66,135 @@ var commands = map[string]command{
 	"autosetup": &autosetupCmd{},
 	"autofix": &autofixCmd{},
 	"set" : &setCmd{},
+	"tools": &toolsCmd{},
+	"reap": &reapCmd{},
+	"history": &historyCmd{},
+	"mount": &mountCmd{},
+	"fixables": &fixablesCmd{},
+}
+
+//exitCode is returned by commands that need to exit with a specific
+//code without printing an error, like exec forwarding the exit code
+//of the executed command
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(e))
 }
 
 func main() {
 	if err := run(); err != nil {
-		// The action we take depends on the error we get.
-		msg := fmt.Sprintf("error: %v", err)
-		switch t := err.(type) {
-		case *url.Error:
-			switch u := t.Err.(type) {
-			case *net.OpError:
-				if u.Op == "dial" && u.Net == "unix" {
-					switch errno := u.Err.(type) {
-					case syscall.Errno:
-						switch errno {
-						case syscall.ENOENT:
-							msg = "LXD socket not found; is LXD running?"
-						case syscall.ECONNREFUSED:
-							msg = "Connection refused; is LXD running?"
-						case syscall.EACCES:
-							msg = "Permisson denied, are you in the lxd group?"
-						default:
-							msg = fmt.Sprintf("%d %s", uintptr(errno), errno.Error())
-						}
+		if code, ok := err.(exitCode); ok {
+			os.Exit(int(code))
+		}
+
+		fmt.Fprintln(os.Stderr, errorMessage(err))
+		os.Exit(errorExitCode(err))
+	}
+}
+
+//errorExitCode maps the errors of the library to the exit codes the
+//IDE expects
+func errorExitCode (err error) int {
+	switch err.(type) {
+	case *ubuntu_sdk_tools.ErrNoAccess:
+		return ERR_NO_ACCESS
+	case *ubuntu_sdk_tools.ErrNeedsFixing:
+		return ERR_NEEDS_FIXING
+	case *ubuntu_sdk_tools.ErrNoBridge:
+		return ERR_NO_BRIDGE
+	case *ubuntu_sdk_tools.ErrNoSpace:
+		return ERR_NO_SPACE
+	}
+	//this includes ErrNotFound, usdk-target exists always failed with 1
+	return 1
+}
+
+func errorMessage (err error) string {
+	// The action we take depends on the error we get.
+	msg := fmt.Sprintf("error: %v", err)
+
+	cause := err
+	if noAccess, ok := err.(*ubuntu_sdk_tools.ErrNoAccess); ok {
+		cause = noAccess.Err
+	}
+
+	switch t := cause.(type) {
+	case *url.Error:
+		switch u := t.Err.(type) {
+		case *net.OpError:
+			if u.Op == "dial" && u.Net == "unix" {
+				switch errno := u.Err.(type) {
+				case syscall.Errno:
+					switch errno {
+					case syscall.ENOENT:
+						msg = "LXD socket not found; is LXD running?"
+					case syscall.ECONNREFUSED:
+						msg = "Connection refused; is LXD running?"
+					case syscall.EACCES:
+						msg = "Permisson denied, are you in the lxd group?"
+					default:
+						msg = fmt.Sprintf("%d %s", uintptr(errno), errno.Error())
 					}
 				}
 			}
 		}
+	}
+	return msg
+}
 
-		fmt.Fprintln(os.Stderr, fmt.Sprintf("%s", msg))
-		os.Exit(1)
+//cleanupTimeout limits how long cleaning up after a failed or canceled
+//command may take
+const cleanupTimeout = time.Minute
+
+func cleanupContext () (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+//signalForwarder is implemented by commands that pass signals on to the
+//process running in the container themselves
+type signalForwarder interface {
+	forwardsSignals() bool
+}
+
+//commandContext returns the context commands run in, it is canceled when
+//the timeout expires or, unless handleSignals is false, when the user
+//presses Ctrl-C, a second Ctrl-C exits immediately
+func commandContext (timeout time.Duration, handleSignals bool) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
+
+	if !handleSignals {
+		return ctx, cancel
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func () {
+		<-ch
+		cancel()
+		<-ch
+		os.Exit(1)
+	} ()
+
+	return ctx, cancel
 }
 
 func run() error {
 	var err error
 
-	ubuntu_sdk_tools.EnsureLXDInitializedOrDie()
+	err = ubuntu_sdk_tools.EnsureLXDInitialized()
+	if err != nil {
+		return err
+	}
 
 	if len(os.Args) < 2 {
-		commands["help"].run(nil)
+		commands["help"].run(context.Background(), nil)
 		os.Exit(1)
 	}
 
@@ -110,11 +202,14 @@ func run() error {
 	name := os.Args[1]
 	cmd, ok := commands[name]
 	if !ok {
-		commands["help"].run(nil)
+		commands["help"].run(context.Background(), nil)
 		fmt.Fprintf(os.Stderr, "\nerror: unknown command: %s\n", name)
 		os.Exit(1)
 	}
 
+	var timeout time.Duration
+	gnuflag.DurationVar(&timeout, "timeout", 0, "Maximum time the command may take, e.g. 5m (default: no limit)")
+
 	cmd.flags()
 	gnuflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s\n\nOptions:\n\n", strings.TrimSpace(cmd.usage()))
@@ -124,7 +219,13 @@ func run() error {
 	os.Args = os.Args[1:]
 	gnuflag.Parse(true)
 
-	err = cmd.run(gnuflag.Args())
+	//exiting on a second Ctrl-C would lose the exit code of the command
+	//running in the container and leak its pidfile
+	forwarder, ok := cmd.(signalForwarder)
+	ctx, cancel := commandContext(timeout, !ok || !forwarder.forwardsSignals())
+	defer cancel()
+
+	err = cmd.run(ctx, gnuflag.Args())
 	if err == errArgs {
 		fmt.Fprintf(os.Stderr, "%s\n\nerror: %v\n", cmd.usage(), err)
 		os.Exit(1)
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/gnuflag"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type mountCmd struct {
+	readOnly bool
+}
+
+func (c *mountCmd) usage() string {
+	return (
+	`Manages project directories shared with a container.
+
+usdk-target mount add [-r] <container> <host-path> [container-path]	Shares a host directory with the container, by default under the same path
+usdk-target mount remove <container> <host-path>	Stops sharing the host directory
+usdk-target mount list <container>	Lists the shared project directories`)
+}
+
+func (c *mountCmd) flags() {
+	gnuflag.BoolVar(&c.readOnly, "r", false, "Mount the directory read-only.")
+}
+
+func (c *mountCmd) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, c.usage())
+		return fmt.Errorf("Missing arguments.")
+	}
+
+	container := args[1]
+
+	client, err := ubuntu_sdk_tools.NewClient("")
+	if err != nil {
+		return err
+	}
+
+	info, err := ubuntu_sdk_tools.GetContainerInfo(client, container)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			return fmt.Errorf("Missing host path.")
+		}
+
+		hostPath, err := filepath.Abs(args[2])
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(hostPath); err != nil || !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", hostPath)
+		}
+
+		containerPath := hostPath
+		if len(args) > 3 {
+			containerPath = filepath.Clean(args[3])
+			if !filepath.IsAbs(containerPath) {
+				return fmt.Errorf("The container path has to be absolute: %s", containerPath)
+			}
+		}
+
+		if info.Devices.ContainsName(ubuntu_sdk_tools.ProjectMountName(hostPath)) {
+			return fmt.Errorf("%s is already shared with %s", hostPath, container)
+		}
+
+		_, err = ubuntu_sdk_tools.AddProjectMount(ctx, client, container, hostPath, containerPath, c.readOnly)
+		return err
+	case "remove":
+		if len(args) < 3 {
+			return fmt.Errorf("Missing host path.")
+		}
+
+		hostPath, err := filepath.Abs(args[2])
+		if err != nil {
+			return err
+		}
+
+		for _, mount := range c.projectMounts(info) {
+			if mount.Source == hostPath {
+				return ubuntu_sdk_tools.RemoveDeviceSync(ctx, client, container, mount.Device)
+			}
+		}
+		return fmt.Errorf("%s is not shared with %s", hostPath, container)
+	case "list":
+		js, err := json.Marshal(c.projectMounts(info))
+		if err != nil {
+			return fmt.Errorf("Could not marshal the result into a valid json string. error: %v.", err)
+		}
+		fmt.Printf("%s\n", js)
+		return nil
+	default:
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+}
+
+func (c *mountCmd) projectMounts (info *shared.ContainerInfo) []ubuntu_sdk_tools.SharedPath {
+	mounts := []ubuntu_sdk_tools.SharedPath{}
+	for _, mount := range ubuntu_sdk_tools.SharedPaths(info) {
+		if strings.HasPrefix(mount.Device, ubuntu_sdk_tools.ProjectMountPrefix) {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"os"
+	"github.com/lxc/lxd/shared/gnuflag"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//progressFlag registers the --progress option of commands reporting
+//the progress of long running operations
+func progressFlag (format *string) {
+	gnuflag.StringVar(format, "progress", ubuntu_sdk_tools.ProgressText, "Format of the progress output: text or json, one object per line")
+}
+
+//newProgress creates the reporter for the requested format, the events
+//are written to stdout. In json mode the informational messages go to
+//stderr, so stdout only contains the progress events
+func newProgress (format string) (ubuntu_sdk_tools.ProgressReporter, error) {
+	progress, err := ubuntu_sdk_tools.NewProgressReporter(format, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == ubuntu_sdk_tools.ProgressJson {
+		ubuntu_sdk_tools.InfoOutput = os.Stderr
+	}
+	return progress, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/gnuflag"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type reapCmd struct {
+	dryRun bool
+}
+
+func (c *reapCmd) usage() string {
+	return `Stops targets that were not used for longer than their idle timeout.
+
+usdk-target reap [-n]`
+}
+
+func (c *reapCmd) flags() {
+	gnuflag.BoolVar(&c.dryRun, "n", false, "Only show which targets would be stopped.")
+}
+
+func (c *reapCmd) run(ctx context.Context, args []string) error {
+	client, err := ubuntu_sdk_tools.NewClient("")
+	if err != nil {
+		return err
+	}
+
+	targets, err := ubuntu_sdk_tools.FindClickTargets(client)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if target.Container.StatusCode != shared.Running {
+			continue
+		}
+
+		timeout, err := ubuntu_sdk_tools.IdleTimeout(target.Container.ExpandedConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", target.Name, err)
+			continue
+		}
+		if timeout <= 0 {
+			continue
+		}
+
+		lastUse, err := ubuntu_sdk_tools.LastUse(target.Name)
+		if err != nil {
+			return err
+		}
+
+		//never stop containers that were started by someone else
+		if lastUse.IsZero() {
+			continue
+		}
+
+		idle := time.Since(lastUse)
+		if idle < timeout {
+			continue
+		}
+
+		fmt.Printf("Stopping %s, idle for %s .....", target.Name, idle - idle % time.Second)
+		if c.dryRun {
+			fmt.Print(" SKIPPED\n")
+			continue
+		}
+
+		err = ubuntu_sdk_tools.StopContainerSync(ctx, client, target.Name)
+		if err != nil {
+			fmt.Print(" FAILED\n")
+			return fmt.Errorf("Could not stop container %s. error: %v.", target.Name, err)
+		}
+		fmt.Print(" DONE\n")
+	}
+	return nil
+}
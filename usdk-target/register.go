@@ -18,16 +18,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"github.com/lxc/lxd/shared/gnuflag"
 	"os/user"
 	"launchpad.net/ubuntu-sdk-tools"
-	"os/exec"
-	"syscall"
-	"strings"
 	"github.com/lxc/lxd"
-	"strconv"
 )
 
 type registerCmd struct {
@@ -54,7 +51,7 @@ func (c *registerCmd) flags() {
 	gnuflag.BoolVar(&c.createGroups, "g", false, "Also try to create the users supplementary groups")
 }
 
-func (c *registerCmd) run(args []string) error {
+func (c *registerCmd) run(ctx context.Context, args []string) error {
 	if (len(args) < 1) {
 		fmt.Fprint(os.Stderr, c.usage())
 		gnuflag.PrintDefaults()
@@ -66,14 +63,12 @@ func (c *registerCmd) run(args []string) error {
 
 	c.container = args[0]
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the LXD server.\n")
-		os.Exit(1)
+		return err
 	}
 
-	return RegisterUserInContainer(client, c.container, &c.user, c.createGroups)
+	return RegisterUserInContainer(ctx, client, c.container, &c.user, c.createGroups)
 }
 
 func userFromEnv () (*string, error) {
@@ -87,11 +82,8 @@ func userFromEnv () (*string, error) {
 		if len(env) == 0 {
 			return nil, nil
 		}
-		fmt.Printf("%s\n", env)
 	}
 
-	fmt.Printf("%s\n", env)
-
 	user, err := user.LookupId(env)
 	if err != nil {
 		return nil, fmt.Errorf("Os environment var :%s contains a invalid USER ID. error: %v", key, err)
@@ -100,7 +92,7 @@ func userFromEnv () (*string, error) {
 	return &user.Username, nil
 }
 
-func RegisterUserInContainer (client *lxd.Client, containerName string, userName *string, createSupGroups bool) (error) {
+func RegisterUserInContainer (ctx context.Context, client *lxd.Client, containerName string, userName *string, createSupGroups bool) (error) {
 	if userName == nil {
 		userNameFromEnv, err := userFromEnv()
 		if err != nil {
@@ -114,7 +106,7 @@ func RegisterUserInContainer (client *lxd.Client, containerName string, userName
 		userName = userNameFromEnv
 	}
 
-	err := ubuntu_sdk_tools.BootContainerSync(client, containerName)
+	err := ubuntu_sdk_tools.BootContainerSync(ctx, client, containerName)
 	if ( err != nil ) {
 		return err
 	}
@@ -128,111 +120,13 @@ func RegisterUserInContainer (client *lxd.Client, containerName string, userName
 		return fmt.Errorf("Registering root is not possible")
 	}
 
-	shadow,err := ubuntu_sdk_tools.Getspnam(*userName)
-	if (err != nil) {
-		return fmt.Errorf("Querying the password entry failed. error: %v", err)
-	}
-
-	groups,err := ubuntu_sdk_tools.GetGroups()
-	if (err != nil) {
-		return fmt.Errorf("Querying the group entry failed. error: %v", err)
-	}
-
-	var requiredGroups []ubuntu_sdk_tools.GroupEntry
-	for _, group := range groups {
-		if group.Gid == pw.Gid {
-			requiredGroups = append(requiredGroups, group)
-			if (createSupGroups) {
-				continue
-			} else {
-				break
-			}
-		}
-		if (createSupGroups) {
-			for _, member := range group.Members {
-				if member == *userName {
-					requiredGroups = append(requiredGroups, group)
-					break
-				}
-			}
-		}
-	}
-
-	err = ubuntu_sdk_tools.AddDeviceSync(client,containerName,
-		fmt.Sprintf("home_of_%s", *userName),
+	err = ubuntu_sdk_tools.AddDeviceSync(ctx, client,containerName,
+		ubuntu_sdk_tools.HomeDeviceName(*userName),
 		"disk",
-		[]string{fmt.Sprintf("source=%s",pw.Dir), fmt.Sprintf("path=%s",pw.Dir), "recursive=true"})
+		ubuntu_sdk_tools.HomeDeviceProps(pw.Dir))
 	if (err != nil) {
 		return fmt.Errorf("Failed to mount home directory of the user: %s. error: %v", *userName, err)
 	}
 
-	fmt.Printf("Creating groups\n")
-	var supplGroups []string
-	for _, group := range requiredGroups {
-		mustWork := group.Gid == pw.Gid
-
-		fmt.Printf("Creating group %s\n", group.Name)
-
-		cmd := exec.Command("lxc", "exec", containerName, "--", "groupadd", "-g",  strconv.FormatUint(uint64(group.Gid),10), group.Name)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err = cmd.Start()
-		if err := cmd.Wait(); err != nil {
-			print ("GroupAdd returned error\n")
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-					//exit code of 9 means the group exists already
-					//which we will treat as success
-					if status.ExitStatus() != 9 {
-						if mustWork {
-							return fmt.Errorf("Could not create primary group")
-						}
-						continue
-					}
-				}
-			} else {
-				return fmt.Errorf("Failed to add the group %s. error: %v", group.Name, err)
-			}
-
-			if !mustWork {
-				supplGroups = append(supplGroups, group.Name)
-			}
-		}
-	}
-
-	fmt.Printf("Creating user %s\n", pw.LoginName)
-
-	command := []string {
-		"exec", containerName, "--",
-		"useradd", "--no-create-home",
-		"-u", strconv.FormatUint(uint64(pw.Uid), 10),
-		"--gid", strconv.FormatUint(uint64(pw.Gid), 10),
-		"--home-dir", pw.Dir,
-		"-s", "/bin/bash",
-		"-p", shadow.Sp_pwdp,
-	}
-
-	containsVideoGroup := false
-	for _, b := range supplGroups {
-		if b == "video" {
-			containsVideoGroup = true
-			break
-		}
-	}
-
-	if !containsVideoGroup {
-		supplGroups = append(supplGroups, "video")
-	}
-
-	if len(supplGroups) > 0 {
-		command = append(command, "--groups",strings.Join(supplGroups, ","))
-	}
-
-	command = append(command,pw.LoginName)
-
-	cmd := exec.Command("lxc", command...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return ubuntu_sdk_tools.CreateUserInContainer(client, containerName, *userName, createSupGroups)
 }
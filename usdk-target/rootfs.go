@@ -20,6 +20,7 @@ package main
 import (
 )
 import (
+	"context"
 	"fmt"
 	"os"
 	"launchpad.net/ubuntu-sdk-tools"
@@ -37,11 +38,11 @@ usdk-target rootfs container`
 func (c *rootfsCmd) flags() {
 }
 
-func (c *rootfsCmd) run(args []string) error {
+func (c *rootfsCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
 		fmt.Fprint(os.Stderr, c.usage())
 		os.Exit(1)
 	}
-	fmt.Printf(ubuntu_sdk_tools.ContainerRootfs(args[0])+"\n")
+	fmt.Println(ubuntu_sdk_tools.ContainerRootfs(args[0]))
 	return nil
 }
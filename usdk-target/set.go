@@ -18,10 +18,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"time"
 	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
 	"launchpad.net/ubuntu-sdk-tools"
+	"launchpad.net/ubuntu-sdk-tools/fixables"
 )
 
 type setCmd struct {
@@ -32,22 +35,29 @@ func (c *setCmd) usage() string {
 	`Change container flags.
 
 usdk-target set <container> upgrades-enabled	Flag container for automatic updgrade checks (from the SDK IDE)
-usdk-target set <container> upgrades-disabled	Flag container for exclusion from automatic updgrade checks (from the SDK IDE)`)
+usdk-target set <container> upgrades-disabled	Flag container for exclusion from automatic updgrade checks (from the SDK IDE)
+usdk-target set <container> journal-enabled	Record the usdk-wrapper invocations and their output in the build journal
+usdk-target set <container> journal-disabled	Stop recording the usdk-wrapper invocations
+usdk-target set <container> env-allow <list>	Comma separated list of additional environment variables forwarded into the container, a trailing * matches a prefix
+usdk-target set <container> env-deny <list>	Comma separated list of environment variables that are never forwarded into the container
+usdk-target set <container> cmake-invalidate <policy>	When usdk-wrapper removes the cmake cache: auto (default, if created by a different target or toolchain), always or never
+usdk-target set <container> idle-timeout <duration>	Stop the container with usdk-target reap after not being used for the given time (e.g. 30m), 0 disables it
+usdk-target set <container> locale <locale>	Locale used for LC_ALL inside the container (default: C), "none" keeps LC_ALL unset
+usdk-target set <container> audio-enabled	Share the PulseAudio or PipeWire socket of the current session with the container
+usdk-target set <container> audio-disabled	Stop sharing the sound server with the container`)
 }
 
 func (c *setCmd) flags() {
 }
 
-func (c *setCmd) run(args []string) error {
+func (c *setCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("Wrong number of arguments")
 	}
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not connect to the container backend.\n")
-		os.Exit(ERR_NO_ACCESS)
+		return err
 	}
 
 	switch args[1] {
@@ -56,10 +66,60 @@ func (c *setCmd) run(args []string) error {
 		err = client.SetContainerConfig(args[0], ubuntu_sdk_tools.TargetUpgradesConfig, "true")
 	case "upgrades-disabled":
 		err = client.SetContainerConfig(args[0], ubuntu_sdk_tools.TargetUpgradesConfig, "false")
+	case "journal-enabled":
+		err = client.SetContainerConfig(args[0], ubuntu_sdk_tools.JournalConfig, "true")
+	case "journal-disabled":
+		err = client.SetContainerConfig(args[0], ubuntu_sdk_tools.JournalConfig, "false")
+	case "env-allow":
+		err = c.setValue(client, args, ubuntu_sdk_tools.EnvAllowConfig)
+	case "env-deny":
+		err = c.setValue(client, args, ubuntu_sdk_tools.EnvDenyConfig)
+	case "cmake-invalidate":
+		if len(args) > 2 && !shared.StringInSlice(args[2], []string{
+			ubuntu_sdk_tools.CMakeInvalidateAuto,
+			ubuntu_sdk_tools.CMakeInvalidateAlways,
+			ubuntu_sdk_tools.CMakeInvalidateNever}) {
+			return fmt.Errorf("Unknown cmake-invalidate policy: %s", args[2])
+		}
+		err = c.setValue(client, args, ubuntu_sdk_tools.CMakeInvalidateConfig)
+	case "idle-timeout":
+		if len(args) > 2 {
+			if _, err := time.ParseDuration(args[2]); err != nil {
+				return fmt.Errorf("Invalid idle timeout: %s", args[2])
+			}
+		}
+		err = c.setValue(client, args, ubuntu_sdk_tools.IdleTimeoutConfig)
+	case "locale":
+		err = c.setValue(client, args, ubuntu_sdk_tools.LocaleConfig)
+	case "audio-enabled":
+		err = c.setAudio(ctx, client, args[0], true)
+	case "audio-disabled":
+		err = c.setAudio(ctx, client, args[0], false)
 	default:
 		return fmt.Errorf("Unknown command: %s", args[1])
 
 	}
 
 	return err
-}
\ No newline at end of file
+}
+
+func (c *setCmd) setValue(client *lxd.Client, args []string, key string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("Missing value for %s", args[1])
+	}
+	return client.SetContainerConfig(args[0], key, args[2])
+}
+
+//setAudio changes the audio flag and shares or removes the sockets right away
+func (c *setCmd) setAudio(ctx context.Context, client *lxd.Client, container string, enabled bool) error {
+	err := client.SetContainerConfig(container, ubuntu_sdk_tools.AudioConfig, fmt.Sprintf("%t", enabled))
+	if err != nil {
+		return err
+	}
+
+	audio, ok := fixables.Lookup("audio")
+	if !ok {
+		return fmt.Errorf("Unknown fixable: audio")
+	}
+	return audio.FixContainer(ctx, client, container)
+}
@@ -20,10 +20,12 @@ package main
 import (
 )
 import (
+	"context"
 	"fmt"
 	"os"
 	"launchpad.net/ubuntu-sdk-tools"
 	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/gnuflag"
 	"encoding/json"
 )
@@ -41,7 +43,7 @@ usdk-target status container`
 func (c *statusCmd) flags() {
 }
 
-func (c *statusCmd) run(args []string) error {
+func (c *statusCmd) run(ctx context.Context, args []string) error {
 	if (len(args) < 1) {
 		fmt.Fprint(os.Stderr, c.usage())
 		gnuflag.PrintDefaults()
@@ -50,11 +52,9 @@ func (c *statusCmd) run(args []string) error {
 
 	c.container = args[0]
 
-	config := ubuntu_sdk_tools.GetConfigOrDie()
-	client, err := lxd.NewClient(config, config.DefaultRemote)
+	client, err := ubuntu_sdk_tools.NewClient("")
 	if err != nil {
-		return fmt.Errorf("Could not connect to the LXD server.")
-		os.Exit(1)
+		return err
 	}
 
 	info, err := client.ContainerState(c.container)
@@ -74,6 +74,10 @@ func (c *statusCmd) run(args []string) error {
 		}
 	}
 
+	if info.StatusCode == shared.Running {
+		c.addCCacheStats(client, result)
+	}
+
 	js, err := json.Marshal(result)
 	if err != nil {
 		return fmt.Errorf("Could not marshal the result into a valid json string. error: %v.", err)
@@ -82,3 +86,19 @@ func (c *statusCmd) run(args []string) error {
 	return nil
 }
 
+func (c *statusCmd) addCCacheStats(client *lxd.Client, result map[string]string) {
+	cInfo, err := client.ContainerInfo(c.container)
+	if err != nil || !ubuntu_sdk_tools.CCacheEnabled(cInfo.ExpandedConfig) {
+		return
+	}
+
+	stats, err := ubuntu_sdk_tools.CCacheStats(client, c.container)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not query the ccache statistics. error: %v\n", err)
+		return
+	}
+
+	for key, val := range stats {
+		result["ccache_"+key] = val
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"encoding/json"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+type toolsCmd struct {
+}
+
+func (c *toolsCmd) usage() string {
+	return (
+	`Manages the usdk-wrapper tool links of a container.
+
+usdk-target tools install <container>	Creates links for the tools found in the containers PATH
+usdk-target tools remove <container>	Removes the tool links of the container
+usdk-target tools list <container>	Lists the tool links of the container`)
+}
+
+func (c *toolsCmd) flags() {
+}
+
+func (c *toolsCmd) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, c.usage())
+		return fmt.Errorf("Missing arguments.")
+	}
+
+	container := args[1]
+
+	switch args[0] {
+	case "install":
+		client, err := ubuntu_sdk_tools.NewClient("")
+		if err != nil {
+			return err
+		}
+
+		tools, err := ubuntu_sdk_tools.InstallToolFarm(ctx, client, container)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Installed %d tools into %s\n", len(tools), ubuntu_sdk_tools.ToolFarmDir(container))
+		return nil
+	case "remove":
+		return ubuntu_sdk_tools.RemoveToolFarm(container)
+	case "list":
+		links, err := ubuntu_sdk_tools.ListToolFarm(container)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("No tools installed for %s", container)
+			}
+			return err
+		}
+
+		result := map[string]interface{}{
+			"directory": ubuntu_sdk_tools.ToolFarmDir(container),
+			"tools": links,
+		}
+
+		js, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("Could not marshal the result into a valid json string. error: %v.", err)
+		}
+		fmt.Printf("%s\n", js)
+		return nil
+	default:
+		return fmt.Errorf("Unknown command: %s", args[0])
+	}
+}
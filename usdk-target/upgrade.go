@@ -20,34 +20,175 @@ package main
 import (
 )
 import (
+	"context"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"launchpad.net/ubuntu-sdk-tools"
 )
 
+//the commands upgrading the container, in json mode apt-get additionally
+//runs non interactively and reports its status on stdout
+var upgradeSteps = []struct {
+	phase string
+	command []string
+}{
+	{"update", []string{"apt-get", "update"}},
+	{"upgrade", []string{"apt-get", "full-upgrade", "--yes"}},
+}
+
+//aptNonInteractiveOptions make apt-get write machine readable status lines
+//to stdout and keep the existing config files instead of asking
+var aptNonInteractiveOptions = []string{
+	"-o", "APT::Status-Fd=1",
+	"-o", "Dpkg::Options::=--force-confdef",
+	"-o", "Dpkg::Options::=--force-confold",
+}
+
 type upgradeCmd struct {
+	progressFormat string
 }
 
 func (c *upgradeCmd) usage() string {
 	return `Upgrades the container.
 
-usdk-target upgrade container`
+usdk-target upgrade [--progress=json] container`
 }
 
 func (c *upgradeCmd) flags() {
+	progressFlag(&c.progressFormat)
 }
 
-func (c *upgradeCmd) run(args []string) error {
+//only the text mode runs through exec, which forwards the signals
+func (c *upgradeCmd) forwardsSignals() bool {
+	return c.progressFormat == ubuntu_sdk_tools.ProgressText
+}
+
+func (c *upgradeCmd) run(ctx context.Context, args []string) error {
 	if len(args) < 1 {
 		fmt.Fprint(os.Stderr, c.usage())
 		os.Exit(1)
 	}
 
+	if c.progressFormat != ubuntu_sdk_tools.ProgressText {
+		progress, err := newProgress(c.progressFormat)
+		if err != nil {
+			return err
+		}
+		return c.upgradeWithProgress(ctx, args[0], progress)
+	}
+
 	exec := &execCmd{maintMode:true}
 
+	commands := []string{}
+	for _, step := range upgradeSteps {
+		quoted := []string{}
+		for _, arg := range step.command {
+			quoted = append(quoted, ubuntu_sdk_tools.QuoteString(arg))
+		}
+		commands = append(commands, strings.Join(quoted, " "))
+	}
+
 	execArgs := []string{
 		args[0],
-		"/bin/bash", "-c", "apt update && apt full-upgrade --yes",
+		"/bin/bash", "-c", strings.Join(commands, " && "),
+	}
+
+	return exec.run(ctx, execArgs)
+}
+
+//upgradeWithProgress runs apt-get non interactively and translates its
+//status messages into progress events
+func (c *upgradeCmd) upgradeWithProgress(ctx context.Context, container string, progress ubuntu_sdk_tools.ProgressReporter) error {
+	client, err := ubuntu_sdk_tools.NewClient("")
+	if err != nil {
+		return err
+	}
+
+	err = ubuntu_sdk_tools.BootContainerSync(ctx, client, container)
+	if err != nil {
+		return err
+	}
+
+	stopKeepAlive := ubuntu_sdk_tools.KeepAlive(container)
+	defer stopKeepAlive()
+
+	for _, step := range upgradeSteps {
+		progress.Report(ubuntu_sdk_tools.ProgressEvent{Phase: step.phase, Percent: 0})
+
+		status := &aptStatusWriter{phase: step.phase, progress: progress}
+		var code int
+		err = ubuntu_sdk_tools.RunWithContext(ctx, fmt.Sprintf("upgrading the container %s", container), func () (err error) {
+			code, err = client.Exec(container,
+				append(append([]string{}, step.command...), aptNonInteractiveOptions...),
+				map[string]string{"DEBIAN_FRONTEND": "noninteractive"},
+				ioutil.NopCloser(bytes.NewReader(nil)),
+				status,
+				os.Stderr,
+				nil, 0, 0)
+			return
+		})
+		if err != nil {
+			return err
+		}
+		status.Close()
+
+		if code != 0 {
+			return fmt.Errorf("%s failed with exit code %d", strings.Join(step.command[:2], " "), code)
+		}
+	}
+
+	progress.Report(ubuntu_sdk_tools.ProgressEvent{Phase: "done", Percent: 100})
+	return nil
+}
+
+//aptStatusWriter parses the lines apt-get writes to APT::Status-Fd,
+//everything else is passed to stderr
+type aptStatusWriter struct {
+	phase string
+	progress ubuntu_sdk_tools.ProgressReporter
+	line bytes.Buffer
+}
+
+func (w *aptStatusWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			w.line.WriteByte(b)
+			continue
+		}
+		w.handleLine(w.line.String())
+		w.line.Reset()
+	}
+	return len(p), nil
+}
+
+func (w *aptStatusWriter) Close() error {
+	if w.line.Len() > 0 {
+		w.handleLine(w.line.String())
+		w.line.Reset()
+	}
+	return nil
+}
+
+func (w *aptStatusWriter) handleLine(line string) {
+	//status lines look like: pmstatus:package:percent:description
+	fields := strings.SplitN(line, ":", 4)
+	if len(fields) != 4 || (fields[0] != "dlstatus" && fields[0] != "pmstatus") {
+		fmt.Fprintln(os.Stderr, line)
+		return
+	}
+
+	percent, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		percent = -1
 	}
 
-	return exec.run(execArgs)
+	w.progress.Report(ubuntu_sdk_tools.ProgressEvent{
+		Phase: w.phase,
+		Percent: int(percent),
+		Message: fields[3],
+	})
 }
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"github.com/lxc/lxd/shared"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//written into the build directory, to know which target and toolchain
+//created the cmake cache
+const cmakeMarkerFile = ".usdk-target"
+
+var cmakeArtifacts = []string{
+	"CMakeFiles",
+	"CMakeCache.txt",
+	"cmake_install.cmake",
+	"Makefile",
+	"build.ninja",
+	"rules.ninja",
+	".ninja_deps",
+	".ninja_log",
+}
+
+//options that run cmake in a mode which does not configure a build dir
+var cmakeNonConfigureOpts = []string{
+	"--build", "--install", "--open", "--find-package", "--version", "-E", "-P", "-N",
+}
+
+type cmakeInvocation struct {
+	buildDir string
+	toolchain string
+	configures bool
+}
+
+func parseCMakeArgs (cwd string, args []string) *cmakeInvocation {
+	inv := &cmakeInvocation{
+		buildDir: cwd,
+		configures: true,
+	}
+
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+
+		if strings.HasPrefix(opt, "--help") || shared.StringInSlice(opt, cmakeNonConfigureOpts) {
+			inv.configures = false
+			return inv
+		}
+
+		//options taking a value either as the next argument or directly attached
+		value := ""
+		switch {
+		case opt == "-B" || opt == "-D" || opt == "--toolchain":
+			if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+		case strings.HasPrefix(opt, "-B") || strings.HasPrefix(opt, "-D"):
+			value = opt[2:]
+		case strings.HasPrefix(opt, "--toolchain="):
+			value = strings.TrimPrefix(opt, "--toolchain=")
+		}
+
+		switch {
+		case strings.HasPrefix(opt, "-B"):
+			if filepath.IsAbs(value) {
+				inv.buildDir = value
+			} else {
+				inv.buildDir = filepath.Join(cwd, value)
+			}
+		case strings.HasPrefix(opt, "--toolchain"):
+			inv.toolchain = value
+		case strings.HasPrefix(opt, "-D") && strings.HasPrefix(value, "CMAKE_TOOLCHAIN_FILE"):
+			if idx := strings.Index(value, "="); idx >= 0 {
+				inv.toolchain = value[idx+1:]
+			}
+		}
+	}
+	return inv
+}
+
+func cmakeMarker (inv *cmakeInvocation, config map[string]string) string {
+	return fmt.Sprintf("target=%s\nframework=%s\narchitecture=%s\ntoolchain=%s\n",
+		container,
+		config[ubuntu_sdk_tools.ClickFrameworkConfig],
+		config[ubuntu_sdk_tools.ClickArchConfig],
+		inv.toolchain)
+}
+
+//prepareCMakeBuildDir removes the cmake cache from the build directory if
+//required by the policy of the target, and records the current target in it
+func prepareCMakeBuildDir (cwd string, args []string, config map[string]string) error {
+	policy := config[ubuntu_sdk_tools.CMakeInvalidateConfig]
+	if len(policy) == 0 {
+		policy = ubuntu_sdk_tools.CMakeInvalidateAuto
+	}
+
+	if policy == ubuntu_sdk_tools.CMakeInvalidateNever {
+		return nil
+	}
+
+	inv := parseCMakeArgs(cwd, args)
+	if !inv.configures {
+		return nil
+	}
+
+	marker := cmakeMarker(inv, config)
+	markerFile := filepath.Join(inv.buildDir, cmakeMarkerFile)
+
+	if _, err := os.Stat(filepath.Join(inv.buildDir, "CMakeCache.txt")); err == nil {
+		invalidate := policy == ubuntu_sdk_tools.CMakeInvalidateAlways
+		if !invalidate {
+			//a cache without marker was created by something else
+			oldMarker, err := ioutil.ReadFile(markerFile)
+			invalidate = err != nil || string(oldMarker) != marker
+		}
+
+		if invalidate {
+			fmt.Printf("-- Removing build artifacts\n")
+			for _, artifact := range cmakeArtifacts {
+				_ = os.RemoveAll(filepath.Join(inv.buildDir, artifact))
+			}
+		}
+	}
+
+	err := os.MkdirAll(inv.buildDir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(markerFile, []byte(marker), 0644)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"launchpad.net/ubuntu-sdk-tools"
+)
+
+//paths starting with one of the system directories are rewritten to point
+//into the rootfs of the container, so the IDE can open the files
+var systemDirs = "/(?:var|bin|boot|dev|etc|lib|lib64|media|mnt|opt|proc|root|run|sbin|srv|sys|usr)"
+var systemDirRegex = regexp.MustCompile("^" + systemDirs)
+var pathCharRegex = regexp.MustCompile("^[\\w.-]")
+
+type pathMapper struct {
+	rootfs string
+	pathsRegex *regexp.Regexp
+	mounts []ubuntu_sdk_tools.SharedPath
+}
+
+type mountsByPathLen []ubuntu_sdk_tools.SharedPath
+
+func (s mountsByPathLen) Len() int { return len(s) }
+func (s mountsByPathLen) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s mountsByPathLen) Less(i, j int) bool { return len(s[i].Path) > len(s[j].Path) }
+
+func newPathMapper (container string, mounts []ubuntu_sdk_tools.SharedPath) *pathMapper {
+	m := &pathMapper{
+		rootfs: ubuntu_sdk_tools.ContainerRootfs(container),
+		mounts: append([]ubuntu_sdk_tools.SharedPath{}, mounts...),
+	}
+
+	//the most specific mount has to win
+	sort.Sort(mountsByPathLen(m.mounts))
+
+	//shared directories can be mounted anywhere in the container, so
+	//their paths are searched for as well
+	prefixes := []string{systemDirs}
+	for _, mount := range m.mounts {
+		if mount.Path != "/" {
+			prefixes = append(prefixes, regexp.QuoteMeta(mount.Path))
+		}
+	}
+	m.pathsRegex = regexp.MustCompile("(^|[^\\w+]|\\s+|-\\w)(" + strings.Join(prefixes, "|") + ")")
+	return m
+}
+
+//findMount returns the mount the path at the start of in belongs to
+func (m *pathMapper) findMount (in string) *ubuntu_sdk_tools.SharedPath {
+	for idx := range m.mounts {
+		mount := &m.mounts[idx]
+		if len(in) < len(mount.Path) || in[:len(mount.Path)] != mount.Path {
+			continue
+		}
+		if len(in) > len(mount.Path) && mount.Path != "/" && pathCharRegex.MatchString(in[len(mount.Path):]) {
+			continue
+		}
+		return mount
+	}
+	return nil
+}
+
+//mapLine rewrites the container paths in a line of output to host paths,
+//files in shared directories are mapped back to their host source
+func (m *pathMapper) mapLine (in string) string {
+	out := ""
+	last := 0
+	for _, loc := range m.pathsRegex.FindAllStringSubmatchIndex(in, -1) {
+		pathStart := loc[4]
+		out += in[last:pathStart]
+
+		if mount := m.findMount(in[pathStart:]); mount != nil {
+			out += mount.Source
+			last = pathStart + len(mount.Path)
+		} else if systemDirRegex.MatchString(in[pathStart:]) {
+			out += m.rootfs
+			last = pathStart
+		} else {
+			//only the prefix of a mount path, e.g. /workspace for /work
+			last = pathStart
+		}
+	}
+	return out + in[last:]
+}
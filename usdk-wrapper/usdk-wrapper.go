@@ -17,34 +17,53 @@
  */
 package main
 import (
+	"context"
 	"github.com/lxc/lxd"
 	"os"
 	"io"
 	"bytes"
-	"regexp"
 	"fmt"
 	"path/filepath"
 	"os/user"
-	"os/signal"
-	"syscall"
+	"sync"
+	"strings"
 	"github.com/pborman/uuid"
 	"launchpad.net/ubuntu-sdk-tools"
-	"path"
 )
 
 var container string
 
-func mapAndWrite (line *bytes.Buffer, out io.WriteCloser) {
-	paths := []string{"var","bin","boot","dev","etc","lib","lib64","media","mnt","opt","proc","root","run","sbin","srv","sys","usr"}
-	in := string(line.Bytes())
-	for _,path := range paths {
-		re := regexp.MustCompile("(^|[^\\w+]|\\s+|-\\w)\\/("+path+")")
-		in = re.ReplaceAllString(in, "$1/var/lib/lxd/containers/"+container+"/rootfs/$2")
+//tools linked with this prefix are executed as root, e.g. maint-apt-get
+const maintPrefix = "maint-"
+
+//name of a registered user (or root) to execute the tool as
+const runAsEnv = "USDK_WRAPPER_USER"
+
+var mapper *pathMapper
+
+func mapAndWrite (line *bytes.Buffer, out io.Writer) {
+	out.Write([]byte(mapper.mapLine(line.String())))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+//withJournal returns a writer that also records into the build journal
+func withJournal (out io.Writer, journal *ubuntu_sdk_tools.JournalRecorder) io.Writer {
+	if journal == nil {
+		return out
 	}
-	out.Write([]byte(in))
+	return io.MultiWriter(out, journal)
 }
 
-func mapFunc (in *io.PipeReader, output io.WriteCloser) {
+func mapFunc (in *io.PipeReader, output io.Writer, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	readBuf := make([]byte, 1)
 	var lineBuf bytes.Buffer
 	defer in.Close()
@@ -69,6 +88,40 @@ func mapFunc (in *io.PipeReader, output io.WriteCloser) {
 	}
 }
 
+//execPiped runs the command without a terminal, the output is
+//passed through the path mapper so the IDE can resolve the files
+func execPiped (cl *lxd.Client, command []string, journal *ubuntu_sdk_tools.JournalRecorder) (int, error) {
+	stdout_r, stdout_w := io.Pipe()
+	stderr_r, stderr_w := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go mapFunc(stdout_r, withJournal(os.Stdout, journal), &wg)
+	go mapFunc(stderr_r, withJournal(os.Stderr, journal), &wg)
+
+	code, err := cl.Exec(container,
+		command,
+		map[string]string{},
+		os.Stdin,
+		stdout_w,
+		stderr_w,
+		nil, 0, 0)
+
+	//closing the writers lets the mappers flush the last line
+	stdout_w.Close()
+	stderr_w.Close()
+	wg.Wait()
+	return code, err
+}
+
+//execInteractive runs the command on a terminal, the output is not
+//mapped as the IDE never runs us that way
+func execInteractive (cl *lxd.Client, command []string, journal *ubuntu_sdk_tools.JournalRecorder) (int, error) {
+	return ubuntu_sdk_tools.ExecInteractive(cl, container, command,
+		map[string]string{},
+		nopWriteCloser{withJournal(os.Stdout, journal)})
+}
+
 func main()  {
 	config := ubuntu_sdk_tools.GetConfigOrDie()
 	cl, err := lxd.NewClient(config, "local")
@@ -87,12 +140,15 @@ func main()  {
 
 	container = filepath.Base(filepath.Dir(toolpath))
 
-	err = ubuntu_sdk_tools.BootContainerSync(cl, container)
+	err = ubuntu_sdk_tools.BootContainerSync(context.Background(), cl, container)
 	if (err != nil) {
 		fmt.Fprintf(os.Stderr, "Error while starting the container: %v\n",err)
 		os.Exit(1)
 	}
 
+	//keep usdk-target reap from stopping the container while we use it
+	stopKeepAlive := ubuntu_sdk_tools.KeepAlive(container)
+
 	//we mirror the current user into the LXD container
 	user, err := user.Current()
 	if err != nil {
@@ -103,27 +159,51 @@ func main()  {
 	cmdName := filepath.Base(os.Args[0])
 	cmdArgs := os.Args[1:]
 
+	runAs := user.Username
+	if strings.HasPrefix(cmdName, maintPrefix) {
+		cmdName = strings.TrimPrefix(cmdName, maintPrefix)
+		runAs = "root"
+	} else if envUser := os.Getenv(runAsEnv); len(envUser) > 0 {
+		runAs = envUser
+	}
+
+	info, err := cl.ContainerInfo(container)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not query the container configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	mapper = newPathMapper(container, ubuntu_sdk_tools.SharedPaths(info))
+
+	//only root and the users registered in the container can be used
+	if runAs != "root" && !info.ExpandedDevices.ContainsName(ubuntu_sdk_tools.HomeDeviceName(runAs)) {
+		fmt.Fprintf(os.Stderr, "The user %s is not registered in %s\n", runAs, container)
+		os.Exit(1)
+	}
+
+	//the rootfs might have been reset, which removes the user again
+	if runAs != "root" {
+		if exists, err := ubuntu_sdk_tools.ContainerHasUser(cl, container, runAs); err == nil && !exists {
+			fmt.Fprintf(os.Stderr, "The user %s is missing in %s, recreate it with: usdk-target autofix registered-users\n", runAs, container)
+			os.Exit(1)
+		}
+	}
+
+	cwd, _ := os.Getwd()
 	if (cmdName == "cmake") {
-		killCache := true
-		for _, opt := range cmdArgs {
-			if (opt == "--help") {
-				killCache = false
-				break
-			} else if (opt == "--build") {
-				killCache = false
-				break
-			}
+		err = prepareCMakeBuildDir(cwd, cmdArgs, info.ExpandedConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not prepare the build directory: %v\n", err)
+			os.Exit(1)
 		}
+	}
 
-		if (killCache) {
-			cwd, _ := os.Getwd()
-			if _, err := os.Stat(path.Join(cwd, "CMakeCache.txt")); err == nil {
-				fmt.Printf("-- Removing build artifacts\n")
-				_= os.RemoveAll(path.Join(cwd, "CMakeFiles"))
-				_= os.Remove(path.Join(cwd, "CMakeCache.txt"))
-				_= os.Remove(path.Join(cwd, "cmake_install.cmake"))
-				_= os.Remove(path.Join(cwd, "Makefile"))
-			}
+	var journal *ubuntu_sdk_tools.JournalRecorder
+	if ubuntu_sdk_tools.JournalEnabled(info.ExpandedConfig) {
+		journal, err = ubuntu_sdk_tools.NewJournalRecorder(container, toolpath, cmdArgs, cwd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not record the build journal: %v\n", err)
+			journal = nil
 		}
 	}
 
@@ -136,59 +216,57 @@ func main()  {
 	u1 := uuid.NewUUID()
 	pidfile := fmt.Sprintf("/tmp/%x.pid", u1)
 
-	rcFiles := []string{ "/etc/profile", "$HOME/.profile" }
-	cwd, _ := os.Getwd()
-
-	program := ""
-	for _,rcfile := range rcFiles {
-		program += "test -f "+rcfile+" && . "+rcfile+"; "
+	containerCwd, err := ubuntu_sdk_tools.ContainerCwd(context.Background(), cl, info, cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 
-	//make sure the working directory is the same
-	program += "cd \""+cwd+"\" && "
+	env := ubuntu_sdk_tools.NewEnvPolicy(info.ExpandedConfig).Environment(os.Environ())
 
-	//write the current shells PID into the pidfile
-	program += fmt.Sprintf("echo $$ > %s; ", pidfile)
+	//the IDE runs QML apps through us, the parts of the display that are not
+	//shared are ignored to keep the build output clean
+	displayEnv, _ := ubuntu_sdk_tools.NewDisplaySession(os.Environ()).Environment(info)
+	for key, val := range displayEnv {
+		env[key] = val
+	}
 
-	//force C locale as QtCreator needs it
-	program +=" LC_ALL=C exec"
+	audioEnv, _ := ubuntu_sdk_tools.AudioEnvironment(info, os.Environ())
+	for key, val := range audioEnv {
+		env[key] = val
+	}
 
-	for _,arg := range args {
-		program += " "+ubuntu_sdk_tools.QuoteString(arg)
+	program := ubuntu_sdk_tools.ShellProgram{
+		Cwd: containerCwd,
+		Env: env,
+		PidFile: pidfile,
+		Args: args,
 	}
 
-	stdout_r, stdout_w := io.Pipe()
-	stderr_r, stderr_w := io.Pipe()
+	ubuntu_sdk_tools.ForwardSignals(cl, container, pidfile)
 
-	go mapFunc(stdout_r, os.Stdout)
-	go mapFunc(stderr_r, os.Stderr)
+	command := []string{"su"}
+	if runAs != "root" {
+		command = append(command, runAs)
+	}
+	command = append(command, "-s", "/bin/bash", "-c", "/bin/bash", "-c", program.String())
 
-	go func () {
-		ch := make(chan os.Signal)
-		signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	var code int
+	if ubuntu_sdk_tools.IsInteractive() {
+		code, err = execInteractive(cl, command, journal)
+	} else {
+		code, err = execPiped(cl, command, journal)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while executing the command: %v\n", err)
+	}
+	stopKeepAlive()
 
-		for {
-			sig := <-ch
-			cl.Exec(container, []string{
-				"/bin/bash",
-				"-c",
-				fmt.Sprintf("kill -%d -$(ps -o pgid= `cat %s` | grep -o '[0-9]*')", sig, pidfile),
-			}, map[string]string{}, os.Stdin, nil, nil, nil, 0, 0)
+	if journal != nil {
+		if jErr := journal.Finish(code); jErr != nil {
+			fmt.Fprintf(os.Stderr, "Could not record the build journal: %v\n", jErr)
 		}
-	} ()
-
-	code, err := cl.Exec(container,
-		[]string{"su", user.Username, "-s", "/bin/bash", "-c", "/bin/bash", "-c", program },
-		map[string]string{},
-		os.Stdin,
-		stdout_w,
-		stderr_w,
-		nil, 0, 0)
-
-	stdout_r.Close()
-        stdout_w.Close()
-	stderr_r.Close()
-        stderr_w.Close()
+	}
 
 	//since the pidfile is created in /tmp and /tmp is mounted into the container
 	//we can just delete the local file
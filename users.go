@@ -0,0 +1,220 @@
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * Author: Benjamin Zeller <benjamin.zeller@canonical.com>
+ */
+package ubuntu_sdk_tools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared"
+)
+
+//PullContainerFile reads a file of the container through LXD, the rootfs of
+//privileged containers is only accessible by root
+func PullContainerFile (client *lxd.Client, container, path string) (io.ReadCloser, error) {
+	_, _, _, fileType, file, _, err := client.PullFile(container, path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s of %s. error: %v", path, container, err)
+	}
+	if fileType != "file" || file == nil {
+		return nil, fmt.Errorf("%s of %s is not a file", path, container)
+	}
+	return file, nil
+}
+
+//ListContainerDir returns the names of the entries in a directory of the
+//container, nil if the directory does not exist
+func ListContainerDir (client *lxd.Client, container, path string) ([]string, error) {
+	_, _, _, fileType, file, entries, err := client.PullFile(container, path)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s of %s. error: %v", path, container, err)
+	}
+	if file != nil {
+		file.Close()
+	}
+	if fileType != "directory" {
+		return nil, nil
+	}
+	return entries, nil
+}
+
+//ContainerHasUser checks the passwd file of the container, the container
+//does not need to run
+func ContainerHasUser (client *lxd.Client, container string, userName string) (bool, error) {
+	file, err := PullContainerFile(client, container, "/etc/passwd")
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.SplitN(scanner.Text(), ":", 2)[0] == userName {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+//ContainerGroups reads the groups of the container through LXD
+func ContainerGroups (client *lxd.Client, container string) ([]GroupEntry, error) {
+	file, err := PullContainerFile(client, container, "/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	groups := []GroupEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		//name:password:gid:member,member
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 4 {
+			continue
+		}
+
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		group := GroupEntry{Gid: uint32(gid), Name: fields[0]}
+		if len(fields[3]) > 0 {
+			group.Members = strings.Split(fields[3], ",")
+		}
+		groups = append(groups, group)
+	}
+	return groups, scanner.Err()
+}
+
+//CreateUserInContainer creates the primary group, optionally the supplementary
+//groups and the user entry of a host user in a running container, the home
+//directory is not created because it is shared with the host
+func CreateUserInContainer (client *lxd.Client, containerName string, userName string, createSupGroups bool) error {
+	pw, err := Getpwnam(userName)
+	if (err != nil) {
+		return fmt.Errorf("Querying the user entry failed. error: %v", err)
+	}
+
+	shadow,err := Getspnam(userName)
+	if (err != nil) {
+		return fmt.Errorf("Querying the password entry failed. error: %v", err)
+	}
+
+	groups,err := GetGroups()
+	if (err != nil) {
+		return fmt.Errorf("Querying the group entry failed. error: %v", err)
+	}
+
+	var requiredGroups []GroupEntry
+	for _, group := range groups {
+		if group.Gid == pw.Gid {
+			requiredGroups = append(requiredGroups, group)
+			if (createSupGroups) {
+				continue
+			} else {
+				break
+			}
+		}
+		if (createSupGroups) {
+			for _, member := range group.Members {
+				if member == userName {
+					requiredGroups = append(requiredGroups, group)
+					break
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(InfoOutput, "Creating groups\n")
+	var supplGroups []string
+	for _, group := range requiredGroups {
+		mustWork := group.Gid == pw.Gid
+
+		fmt.Fprintf(InfoOutput, "Creating group %s\n", group.Name)
+
+		res, err := ExecSync(client, containerName, []string{
+			"groupadd", "-g", strconv.FormatUint(uint64(group.Gid),10), group.Name,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to add the group %s. error: %v", group.Name, err)
+		}
+
+		//exit code of 9 means the group exists already
+		//which we will treat as success
+		if res.Code != 0 && res.Code != 9 {
+			groupErr := &ExecError{Command: []string{"groupadd", group.Name}, Result: res}
+			if mustWork {
+				return fmt.Errorf("Could not create primary group. error: %v", groupErr)
+			}
+			fmt.Fprintf(os.Stderr, "Skipping group %s. error: %v\n", group.Name, groupErr)
+			continue
+		}
+
+		if !mustWork {
+			supplGroups = append(supplGroups, group.Name)
+		}
+	}
+
+	fmt.Fprintf(InfoOutput, "Creating user %s\n", pw.LoginName)
+
+	command := []string {
+		"useradd", "--no-create-home",
+		"-u", strconv.FormatUint(uint64(pw.Uid), 10),
+		"--gid", strconv.FormatUint(uint64(pw.Gid), 10),
+		"--home-dir", pw.Dir,
+		"-s", "/bin/bash",
+		"-p", shadow.Sp_pwdp,
+	}
+
+	//video used to own the GPU device nodes, newer hosts use render for
+	//the render nodes the gpu fixable shares
+	gpuGroups, err := GPUGroups(client, containerName)
+	if err != nil {
+		return fmt.Errorf("Querying the GPU groups failed. error: %v", err)
+	}
+	for _, group := range append([]string{"video"}, gpuGroups...) {
+		if !shared.StringInSlice(group, supplGroups) {
+			supplGroups = append(supplGroups, group)
+		}
+	}
+
+	if len(supplGroups) > 0 {
+		command = append(command, "--groups",strings.Join(supplGroups, ","))
+	}
+
+	command = append(command,pw.LoginName)
+
+	res, err := ExecSync(client, containerName, command)
+	if err != nil {
+		return fmt.Errorf("Failed to add the user %s. error: %v", pw.LoginName, err)
+	}
+	if res.Code != 0 {
+		//the command line contains the password hash, do not show it
+		userErr := &ExecError{Command: []string{"useradd", pw.LoginName}, Result: res}
+		return fmt.Errorf("Failed to add the user %s. error: %v", pw.LoginName, userErr)
+	}
+	return nil
+}